@@ -0,0 +1,442 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The hashmap package re-implements Go's builtin map type.
+package hashmap
+
+import "container/hashmap/sizing"
+import "fmt"
+import "io"
+import "unsafe"
+
+// These seem right, Java's lower 0.75 bound resizes too
+// much, a higher 1.15 or 1.25 bound makes chains grow
+const loadGrow = 1.0
+const loadShrink = 0.25
+
+// Hashable is an interface that keys have to implement.
+type Hashable interface {
+	Hash() uint
+	Equal(other Hashable) bool
+}
+
+// HashMap is the container itself.
+// You must call Init() before using it.
+type HashMap struct {
+	data	[]int // chain heads, each should be short
+	nodes	slab // all chains live here
+	trees	map[int]*treeNode // chains that got long, if any
+	mixed	map[int]bool // long chains whose keys can't make a tree
+	count	int // to compute load factor
+	policy	sizing.SizePolicy // table sizes
+	grows	int // for Stats()
+	shrinks	int
+	watch	observers
+}
+
+// HashPair is a key and a value.
+// Iter() yields HashPairs.
+type HashPair struct {
+	Key Hashable
+	Value interface{}
+}
+
+func (self *HashMap) loadFactor() float {
+//	fmt.Printf("loadFactor %d/%d\n", self.count, len(self.data))
+	return float(self.count) / float(len(self.data))
+}
+
+// Nodes stay where they are, only their links change.
+func (self *HashMap) rehashInto(data []int) {
+//	fmt.Printf("rehashInto %d\n", len(data))
+	for _, b := range self.data {
+		for i := b; i != 0; {
+			n := self.nodes.at(i)
+			next := n.next
+			h := n.pair.Key.Hash() % uint(len(data))
+			n.next = data[h]
+			data[h] = i
+			i = next
+		}
+	}
+}
+
+func (self *HashMap) grow() {
+//	fmt.Printf("grow\n")
+	s := self.policy.Grow(uint64(len(self.data)))
+	if s == 0 {
+		panic("grow: can't grow bigger!")
+	}
+	d := make([]int, s)
+	self.rehashInto(d)
+	self.watch.resized(len(self.data), len(d))
+	self.data = d
+	self.retreeify()
+	self.grows++
+}
+
+func (self *HashMap) shrink() {
+//	fmt.Printf("shrink\n")
+	s := self.policy.Shrink(uint64(len(self.data)))
+	if s == uint64(len(self.data)) {
+		return
+	}
+	d := make([]int, s)
+	self.rehashInto(d)
+	self.watch.resized(len(self.data), len(d))
+	self.data = d
+	self.retreeify()
+	self.shrinks++
+}
+
+// Returns the bucket and the node for key (0 if not found)
+// together with its predecessor in the chain (0 if none, or
+// if the bucket is a tree).
+func (self *HashMap) find(key Hashable) (b int, position int, prev int) {
+//	fmt.Printf("find %s\n", key)
+	h := key.Hash() % uint(len(self.data))
+	if t := self.tree(int(h)); t != nil {
+		// all keys in a tree have the same type
+		k, ok := key.(Ordered)
+		if ok && sameType(key, t.key) {
+			if n := t.get(k); n != nil {
+				return int(h), n.pos, 0
+			}
+		}
+		return int(h), 0, 0
+	}
+	for i := self.data[h]; i != 0; prev, i = i, self.nodes.at(i).next {
+		if keysEqual(key, self.nodes.at(i).pair.Key) {
+			return int(h), i, prev
+		}
+	}
+	return int(h), 0, prev
+}
+
+// Whether chain b is shorter than n, without walking past
+// n nodes.
+func (self *HashMap) chainShorter(b int, n int) bool {
+	for i := self.data[b]; i != 0; i = self.nodes.at(i).next {
+		n--
+		if n == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// The tree indexing chain b, nil if there is none. Tree
+// nodes hold the slab index of their pair as pos.
+func (self *HashMap) tree(b int) *treeNode {
+	if self.trees == nil {
+		return nil
+	}
+	return self.trees[b]
+}
+
+// Index chain b in a tree, unless some key isn't Ordered
+// or they aren't all of one type.
+func (self *HashMap) treeify(b int) {
+	var t *treeNode
+	first := self.nodes.at(self.data[b]).pair.Key
+	for i := self.data[b]; i != 0; i = self.nodes.at(i).next {
+		key := self.nodes.at(i).pair.Key
+		k, ok := key.(Ordered)
+		if !ok || !sameType(key, first) {
+			self.setMixed(b)
+			return
+		}
+		t = treeInsert(t, k, i)
+	}
+	if self.trees == nil {
+		self.trees = make(map[int]*treeNode)
+	}
+	self.trees[b] = t
+}
+
+func (self *HashMap) untreeify(b int) {
+	self.trees[b] = nil, false
+	if len(self.trees) == 0 {
+		self.trees = nil
+	}
+}
+
+// Remember that chain b can't be a tree, so pushes don't try
+// to treeify it again until it gets shorter than
+// untreeifyLength.
+func (self *HashMap) setMixed(b int) {
+	if self.mixed == nil {
+		self.mixed = make(map[int]bool)
+	}
+	self.mixed[b] = true
+}
+
+// Rehashing scatters the chains, so start over.
+func (self *HashMap) retreeify() {
+	self.trees = nil
+	self.mixed = nil
+	for b := range self.data {
+		if !self.chainShorter(b, treeifyLength) {
+			self.treeify(b)
+		}
+	}
+}
+
+// Index the new head of chain b in its tree, or turn the
+// chain into a tree if it got long.
+func (self *HashMap) pushed(b int) {
+	head := self.data[b]
+	key := self.nodes.at(head).pair.Key
+	k, ok := key.(Ordered)
+	if t := self.tree(b); t != nil {
+		if ok && sameType(key, t.key) {
+			self.trees[b] = treeInsert(t, k, head)
+		} else {
+			self.untreeify(b)
+			self.setMixed(b)
+		}
+		return
+	}
+	if ok && !self.mixed[b] && !self.chainShorter(b, treeifyLength) {
+		self.treeify(b)
+	}
+}
+
+// Trees don't keep the chain order, the head moves into the
+// hole instead so no predecessor is needed.
+func (self *HashMap) popTree(b int, t *treeNode, position int) {
+	n := self.nodes.at(position)
+	t = treeRemove(t, n.pair.Key.(Ordered))
+	head := self.data[b]
+	h := self.nodes.at(head)
+	if position != head {
+		n.pair = h.pair
+		t.get(n.pair.Key.(Ordered)).pos = position
+	}
+	self.data[b] = h.next
+	self.nodes.release(head)
+	if self.chainShorter(b, untreeifyLength) {
+		self.untreeify(b)
+	} else {
+		self.trees[b] = t
+	}
+}
+
+// Init initializes or clears a HashMap, sizing its table
+// in powers of two.
+func (self *HashMap) Init() *HashMap {
+	return self.InitWithPolicy(sizing.PowerOfTwo)
+}
+
+// InitWithPolicy initializes or clears a HashMap that sizes
+// its table according to p.
+func (self *HashMap) InitWithPolicy(p sizing.SizePolicy) *HashMap {
+//	fmt.Printf("InitWithPolicy %s\n", self)
+	self.watch.start()
+	if len(self.watch.list) > 0 {
+		// clearing, the observers see everything go
+		self.Do(func(key Hashable, value interface{}) { self.watch.removed(key, value) })
+		if self.data != nil && uint64(len(self.data)) != p.Initial() {
+			self.watch.resized(len(self.data), int(p.Initial()))
+		}
+	}
+	self.policy = p
+	self.data = make([]int, p.Initial())
+	self.nodes = slab{}
+	self.trees = nil
+	self.mixed = nil
+	self.count = 0
+	self.grows = 0
+	self.shrinks = 0
+	self.watch.end()
+	return self
+}
+
+// New returns an initialized hashmap.
+func New() *HashMap {
+//	fmt.Printf("New\n")
+	return new(HashMap).Init()
+}
+
+// NewWithPolicy returns an initialized hashmap that sizes
+// its table according to p.
+func NewWithPolicy(p sizing.SizePolicy) *HashMap {
+//	fmt.Printf("NewWithPolicy\n")
+	return new(HashMap).InitWithPolicy(p)
+}
+
+func (self *HashMap) Insert(key Hashable, value interface{}) {
+//	fmt.Printf("Insert %s->%s\n", key, value)
+	self.watch.start()
+	b, position, _ := self.find(key)
+	if position != 0 {
+		panic("HashMap.Insert: duplicate key")
+	}
+
+	if self.loadFactor() >= loadGrow {
+		self.grow()
+		b = int(key.Hash() % uint(len(self.data)))
+	}
+
+	self.data[b] = self.nodes.alloc(HashPair{key, value}, self.data[b])
+	self.pushed(b)
+	self.count++
+	self.watch.inserted(key, value)
+	self.watch.end()
+}
+
+func (self *HashMap) Remove(key Hashable) {
+//	fmt.Printf("Remove %s\n", key)
+//	fmt.Printf("%s\n", self)
+	self.watch.start()
+	b, position, prev := self.find(key)
+	if position == 0 {
+		panic("HashMap.Remove: key not found")
+	}
+	e := self.nodes.at(position).pair
+
+	if t := self.tree(b); t != nil {
+		self.popTree(b, t, position)
+	} else {
+		next := self.nodes.at(position).next
+		if prev == 0 {
+			self.data[b] = next
+		} else {
+			self.nodes.at(prev).next = next
+		}
+		self.nodes.release(position)
+		if self.mixed[b] && self.chainShorter(b, untreeifyLength) {
+			self.mixed[b] = false, false
+		}
+	}
+	self.count--
+	self.watch.removed(e.Key, e.Value)
+
+	if self.loadFactor() <= loadShrink {
+		self.shrink()
+	}
+	self.watch.end()
+}
+
+func (self *HashMap) At(key Hashable) interface{} {
+//	fmt.Printf("At %s\n", key)
+	_, position, _ := self.find(key)
+	if position == 0 {
+		panic("HashMap.At: key not found")
+	}
+	return self.nodes.at(position).pair.Value
+}
+
+func (self *HashMap) Set(key Hashable, value interface{}) {
+//	fmt.Printf("Set %s->%s\n", key, value)
+	self.watch.start()
+	_, position, _ := self.find(key)
+	if position == 0 {
+		panic("HashMap.Set: key not found")
+	}
+	e := &self.nodes.at(position).pair
+	self.watch.updated(key, e.Value, value)
+	e.Value = value
+	self.watch.end()
+}
+
+func (self *HashMap) Has(key Hashable) bool {
+//	fmt.Printf("Has %s\n", key)
+	_, position, _ := self.find(key)
+	return position != 0
+}
+
+func (self *HashMap) Len() int {
+//	fmt.Printf("Len %d\n", self.count)
+	return self.count
+}
+
+func (self *HashMap) Do(f func(key Hashable, value interface{})) {
+//	fmt.Printf("Do %s\n", f)
+	for _, b := range self.data {
+		for i := b; i != 0; {
+			n := self.nodes.at(i)
+			f(n.pair.Key, n.pair.Value)
+			i = n.next
+		}
+	}
+}
+
+// Range calls f for every pair until f returns false.
+func (self *HashMap) Range(f func(key Hashable, value interface{}) bool) {
+//	fmt.Printf("Range %s\n", f)
+	for _, b := range self.data {
+		for i := b; i != 0; {
+			n := self.nodes.at(i)
+			if !f(n.pair.Key, n.pair.Value) {
+				return
+			}
+			i = n.next
+		}
+	}
+}
+
+func (self *HashMap) iterate(c chan<- interface{}) {
+//	fmt.Printf("Iterate %s\n", c)
+	for _, b := range self.data {
+		for i := b; i != 0; {
+			n := self.nodes.at(i)
+			c <- n.pair
+			i = n.next
+		}
+	}
+	close(c)
+}
+
+func (self *HashMap) Iter() <-chan interface{} {
+//	fmt.Printf("Iter\n")
+	c := make(chan interface{})
+	go self.iterate(c)
+	return c
+}
+
+func (self *HashMap) chainLength(b int) int {
+	n := 0
+	for i := self.data[b]; i != 0; i = self.nodes.at(i).next {
+		n++
+	}
+	return n
+}
+
+// Stats describes the table; Grows and Shrinks count the
+// rehashes since Init().
+func (self *HashMap) Stats() Stats {
+//	fmt.Printf("Stats\n")
+	var s Stats
+	s.Buckets = len(self.data)
+	s.Entries = self.count
+	s.LoadFactor = self.loadFactor()
+	s.Bytes = int(unsafe.Sizeof(*self)) + len(self.data)*int(unsafe.Sizeof(int(0))) +
+		self.nodes.size()*int(unsafe.Sizeof(slabNode{}))
+	for b := range self.data {
+		s.ChainLengths = histogram(s.ChainLengths, self.chainLength(b))
+	}
+	s.Grows = self.grows
+	s.Shrinks = self.shrinks
+	return s
+}
+
+// Dump writes the length of every chain to w, '.' for
+// empty ones and '+' for 10 or more.
+func (self *HashMap) Dump(w io.Writer) {
+//	fmt.Printf("Dump\n")
+	dump(w, self.Stats(), func(i int) byte {
+		return chainCell(self.chainLength(i))
+	})
+}
+
+func (self *HashMap) String() string {
+	s := "{"
+	for r := range self.Iter() {
+		q := r.(HashPair)
+		s = s + fmt.Sprintf("%s: %s, ", q.Key, q.Value)
+	}
+	s = s + "}"
+	return s
+}
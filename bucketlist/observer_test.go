@@ -0,0 +1 @@
+../observer_test.go
\ No newline at end of file
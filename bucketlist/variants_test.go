@@ -0,0 +1 @@
+../variants_test.go
\ No newline at end of file
@@ -0,0 +1,76 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The cache package implements bounded caches on top of
+// container/hashmap. The HashMap maps keys to entries,
+// and entries are threaded onto intrusive doubly linked
+// lists so that Get, Put, and eviction are all O(1).
+package cache
+
+import "container/hashmap"
+
+// CostFunc returns the cost of keeping a pair in a cache.
+// Without one, every pair costs 1 and the capacity is an
+// entry count.
+type CostFunc func(key hashmap.Hashable, value interface{}) int
+
+// EvictFunc is called for every pair a cache evicts to stay
+// within its capacity. It is not called for Remove.
+type EvictFunc func(key hashmap.Hashable, value interface{})
+
+// Stats counts lookups and evictions since the cache was
+// initialized.
+type Stats struct {
+	Hits		uint64
+	Misses		uint64
+	Evictions	uint64
+}
+
+// HitRate returns the fraction of lookups that were hits.
+func (self Stats) HitRate() float {
+	total := self.Hits + self.Misses
+	if total == 0 {
+		return 0
+	}
+	return float(self.Hits) / float(total)
+}
+
+// Entries live on exactly one list at a time, the list
+// head is a sentinel so there are no nil checks.
+type entry struct {
+	key		hashmap.Hashable
+	value		interface{}
+	cost		int
+	freq		*freqNode // only used by LFU
+	prev, next	*entry
+}
+
+func (self *entry) initList() {
+	self.prev = self
+	self.next = self
+}
+
+func (self *entry) empty() bool { return self.next == self }
+
+// Insert e right after self.
+func (self *entry) pushFront(e *entry) {
+	e.prev = self
+	e.next = self.next
+	self.next.prev = e
+	self.next = e
+}
+
+func (self *entry) unlink() {
+	self.prev.next = self.next
+	self.next.prev = self.prev
+	self.prev = nil
+	self.next = nil
+}
+
+func cost(f CostFunc, key hashmap.Hashable, value interface{}) int {
+	if f == nil {
+		return 1
+	}
+	return f(key, value)
+}
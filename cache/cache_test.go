@@ -0,0 +1,134 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import "container/hashmap"
+import "testing"
+
+type Integer int
+
+func (self Integer) Hash() uint { return uint(self*self) }
+func (self Integer) Equal(other hashmap.Hashable) bool { return self == other.(Integer) }
+
+func TestLRUEvictsOldest(t *testing.T) {
+	const Cap = 100
+	evicted := make([]Integer, Cap)
+	n := 0
+	c := NewLRU(Cap)
+	c.OnEvict = func(key hashmap.Hashable, value interface{}) {
+		evicted[n] = key.(Integer)
+		n++
+	}
+	for i := 0; i < Cap; i++ {
+		c.Put(Integer(i), i)
+	}
+	// touch the first half so the second half is older
+	for i := 0; i < Cap/2; i++ {
+		c.Get(Integer(i))
+	}
+	for i := Cap; i < Cap+Cap/2; i++ {
+		c.Put(Integer(i), i)
+	}
+	if c.Len() != Cap {
+		t.Errorf("expected %d, got %d", Cap, c.Len())
+	}
+	for i, k := range evicted[0:n] {
+		if k != Integer(Cap/2+i) {
+			t.Errorf("eviction %d: expected %d, got %d", i, Cap/2+i, k)
+		}
+	}
+	if n != Cap/2 {
+		t.Errorf("expected %d evictions, got %d", Cap/2, n)
+	}
+	for i := 0; i < Cap/2; i++ {
+		if _, ok := c.Peek(Integer(i)); !ok {
+			t.Errorf("recently used %d was evicted", i)
+		}
+	}
+}
+
+func TestLRUCost(t *testing.T) {
+	c := NewLRU(10)
+	c.Cost = func(key hashmap.Hashable, value interface{}) int { return value.(int) }
+	c.Put(Integer(1), 4)
+	c.Put(Integer(2), 4)
+	c.Put(Integer(3), 4) // evicts 1
+	if _, ok := c.Peek(Integer(1)); ok {
+		t.Error("expected 1 to be evicted")
+	}
+	if c.TotalCost() != 8 {
+		t.Errorf("expected cost 8, got %d", c.TotalCost())
+	}
+	c.Put(Integer(2), 1) // replacing adjusts the cost
+	if c.TotalCost() != 5 {
+		t.Errorf("expected cost 5, got %d", c.TotalCost())
+	}
+}
+
+func TestLFUEvictsLeastUsed(t *testing.T) {
+	const Cap = 10
+	c := NewLFU(Cap)
+	for i := 0; i < Cap; i++ {
+		c.Put(Integer(i), i)
+		for j := 0; j < i; j++ {
+			c.Get(Integer(i))
+		}
+	}
+	c.Put(Integer(Cap), Cap) // evicts 0, used least
+	if _, ok := c.Peek(Integer(0)); ok {
+		t.Error("expected 0 to be evicted")
+	}
+	c.Put(Integer(Cap+1), Cap+1) // evicts Cap, the only other count of one
+	if _, ok := c.Peek(Integer(Cap)); ok {
+		t.Errorf("expected %d to be evicted", Cap)
+	}
+	for i := 1; i < Cap; i++ {
+		if _, ok := c.Peek(Integer(i)); !ok {
+			t.Errorf("frequently used %d was evicted", i)
+		}
+	}
+	if c.Stats().Evictions != 2 {
+		t.Errorf("expected 2 evictions, got %d", c.Stats().Evictions)
+	}
+}
+
+// A new key used to have the lowest count when eviction ran
+// and evicted itself.
+func TestLFUKeepsNewKey(t *testing.T) {
+	var evicted []Integer
+	c := NewLFU(2)
+	c.OnEvict = func(key hashmap.Hashable, value interface{}) {
+		evicted = []Integer{key.(Integer)}
+	}
+	for i := 1; i <= 2; i++ {
+		c.Put(Integer(i), i)
+		c.Get(Integer(i))
+	}
+	c.Put(Integer(3), 3)
+	if _, ok := c.Get(Integer(3)); !ok {
+		t.Error("new key 3 was evicted right away")
+	}
+	if len(evicted) != 1 || evicted[0] != 1 {
+		t.Errorf("expected 1 to be evicted, got %v", evicted)
+	}
+	if c.Len() != 2 {
+		t.Errorf("expected 2 pairs, got %d", c.Len())
+	}
+}
+
+func TestStats(t *testing.T) {
+	c := NewLRU(10)
+	c.Put(Integer(1), 1)
+	c.Get(Integer(1))
+	c.Get(Integer(1))
+	c.Get(Integer(2))
+	s := c.Stats()
+	if s.Hits != 2 || s.Misses != 1 {
+		t.Errorf("expected 2 hits and 1 miss, got %d and %d", s.Hits, s.Misses)
+	}
+	if r := s.HitRate(); r < 0.66 || r > 0.67 {
+		t.Errorf("expected hit rate 2/3, got %f", r)
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import "container/hashmap"
+
+// Entries with the same use count share a freqNode; the
+// nodes form a list in increasing count order. Within a
+// node the most recently used entry is at the front, so
+// ties are broken in LRU order.
+type freqNode struct {
+	count		uint64
+	entries		entry
+	prev, next	*freqNode
+}
+
+// LFU evicts the least frequently used pairs first.
+// Set Cost and OnEvict before the first Put.
+// You must call Init() before using it.
+type LFU struct {
+	Cost		CostFunc
+	OnEvict		EvictFunc
+	index		*hashmap.HashMap // key -> *entry
+	freqs		freqNode // sentinel, lowest count at next
+	capacity	int
+	cost		int
+	stats		Stats
+}
+
+// Init initializes or clears an LFU with the given capacity.
+func (self *LFU) Init(capacity int) *LFU {
+	self.index = hashmap.New()
+	self.freqs.prev = &self.freqs
+	self.freqs.next = &self.freqs
+	self.capacity = capacity
+	self.cost = 0
+	self.stats = Stats{}
+	return self
+}
+
+// NewLFU returns an initialized LFU cache.
+func NewLFU(capacity int) *LFU {
+	return new(LFU).Init(capacity)
+}
+
+func (self *LFU) lookup(key hashmap.Hashable) *entry {
+	if e, ok := self.index.Lookup(key); ok {
+		return e.(*entry)
+	}
+	return nil
+}
+
+// Return the node for count right after prev, creating it
+// if necessary.
+func (self *LFU) nodeAfter(prev *freqNode, count uint64) *freqNode {
+	if prev.next != &self.freqs && prev.next.count == count {
+		return prev.next
+	}
+	n := &freqNode{count: count, prev: prev, next: prev.next}
+	n.entries.initList()
+	prev.next.prev = n
+	prev.next = n
+	return n
+}
+
+// Take e off its node, dropping the node if it empties.
+func (self *LFU) detach(e *entry) {
+	n := e.freq
+	e.unlink()
+	e.freq = nil
+	if n.entries.empty() {
+		n.prev.next = n.next
+		n.next.prev = n.prev
+	}
+}
+
+func (self *LFU) touch(e *entry) {
+	n := e.freq
+	next := self.nodeAfter(n, n.count+1)
+	self.detach(e)
+	next.entries.pushFront(e)
+	e.freq = next
+}
+
+func (self *LFU) drop(e *entry) {
+	self.detach(e)
+	self.index.Remove(e.key)
+	self.cost -= e.cost
+}
+
+func (self *LFU) evict() {
+	for self.cost > self.capacity && self.freqs.next != &self.freqs {
+		e := self.freqs.next.entries.prev
+		self.drop(e)
+		self.stats.Evictions++
+		if self.OnEvict != nil {
+			self.OnEvict(e.key, e.value)
+		}
+	}
+}
+
+// Get returns the value for key and counts a use.
+func (self *LFU) Get(key hashmap.Hashable) (value interface{}, ok bool) {
+	e := self.lookup(key)
+	if e == nil {
+		self.stats.Misses++
+		return nil, false
+	}
+	self.stats.Hits++
+	self.touch(e)
+	return e.value, true
+}
+
+// Peek returns the value for key without counting a use
+// or touching the statistics.
+func (self *LFU) Peek(key hashmap.Hashable) (value interface{}, ok bool) {
+	e := self.lookup(key)
+	if e == nil {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Put adds or replaces the value for key, then evicts until
+// the cache is within its capacity again. Replacing a value
+// counts as a use; a new pair starts with a count of one.
+func (self *LFU) Put(key hashmap.Hashable, value interface{}) {
+	c := cost(self.Cost, key, value)
+	if e := self.lookup(key); e != nil {
+		self.cost -= e.cost
+		self.touch(e)
+		e.value = value
+		e.cost = c
+		self.cost += c
+		self.evict()
+		return
+	}
+	// make room before linking the new pair in: its count is
+	// the lowest of all, so it would be the first to go
+	self.cost += c
+	self.evict()
+	e := &entry{key: key, value: value, cost: c}
+	self.index.Insert(key, e)
+	n := self.nodeAfter(&self.freqs, 1)
+	n.entries.pushFront(e)
+	e.freq = n
+	self.evict() // just e, if it alone is over capacity
+}
+
+// Remove drops key from the cache, returns false if it
+// was not there.
+func (self *LFU) Remove(key hashmap.Hashable) bool {
+	e := self.lookup(key)
+	if e == nil {
+		return false
+	}
+	self.drop(e)
+	return true
+}
+
+func (self *LFU) Len() int { return self.index.Len() }
+
+// TotalCost returns the total cost of all pairs in the cache.
+func (self *LFU) TotalCost() int { return self.cost }
+
+func (self *LFU) Stats() Stats { return self.stats }
@@ -0,0 +1,120 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import "container/hashmap"
+
+// LRU evicts the least recently used pairs first.
+// Set Cost and OnEvict before the first Put.
+// You must call Init() before using it.
+type LRU struct {
+	Cost		CostFunc
+	OnEvict		EvictFunc
+	index		*hashmap.HashMap // key -> *entry
+	order		entry // most recently used at the front
+	capacity	int
+	cost		int
+	stats		Stats
+}
+
+// Init initializes or clears an LRU with the given capacity.
+func (self *LRU) Init(capacity int) *LRU {
+	self.index = hashmap.New()
+	self.order.initList()
+	self.capacity = capacity
+	self.cost = 0
+	self.stats = Stats{}
+	return self
+}
+
+// NewLRU returns an initialized LRU cache.
+func NewLRU(capacity int) *LRU {
+	return new(LRU).Init(capacity)
+}
+
+func (self *LRU) lookup(key hashmap.Hashable) *entry {
+	if e, ok := self.index.Lookup(key); ok {
+		return e.(*entry)
+	}
+	return nil
+}
+
+func (self *LRU) drop(e *entry) {
+	e.unlink()
+	self.index.Remove(e.key)
+	self.cost -= e.cost
+}
+
+func (self *LRU) evict() {
+	for self.cost > self.capacity && !self.order.empty() {
+		e := self.order.prev
+		self.drop(e)
+		self.stats.Evictions++
+		if self.OnEvict != nil {
+			self.OnEvict(e.key, e.value)
+		}
+	}
+}
+
+// Get returns the value for key and marks it as most
+// recently used.
+func (self *LRU) Get(key hashmap.Hashable) (value interface{}, ok bool) {
+	e := self.lookup(key)
+	if e == nil {
+		self.stats.Misses++
+		return nil, false
+	}
+	self.stats.Hits++
+	e.unlink()
+	self.order.pushFront(e)
+	return e.value, true
+}
+
+// Peek returns the value for key without touching its
+// recency or the statistics.
+func (self *LRU) Peek(key hashmap.Hashable) (value interface{}, ok bool) {
+	e := self.lookup(key)
+	if e == nil {
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Put adds or replaces the value for key, then evicts until
+// the cache is within its capacity again.
+func (self *LRU) Put(key hashmap.Hashable, value interface{}) {
+	c := cost(self.Cost, key, value)
+	e := self.lookup(key)
+	if e == nil {
+		e = &entry{key: key}
+		self.index.Insert(key, e)
+	} else {
+		e.unlink()
+		self.cost -= e.cost
+	}
+	e.value = value
+	e.cost = c
+	self.cost += c
+	self.order.pushFront(e)
+	self.evict()
+}
+
+// Remove drops key from the cache, returns false if it
+// was not there.
+func (self *LRU) Remove(key hashmap.Hashable) bool {
+	e := self.lookup(key)
+	if e == nil {
+		return false
+	}
+	self.drop(e)
+	return true
+}
+
+func (self *LRU) Len() int { return self.index.Len() }
+
+// TotalCost returns the total cost of all pairs in the cache.
+func (self *LRU) TotalCost() int { return self.cost }
+
+func (self *LRU) Stats() Stats { return self.stats }
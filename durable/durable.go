@@ -0,0 +1,325 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The durable package keeps a container/hashmap on disk.
+// Every change is appended to a write-ahead log before the
+// map sees it, so Open gets back every change whose record
+// made it to the disk, crash or not. Compact writes all of
+// the map to a snapshot file and starts a fresh log.
+package durable
+
+//import "fmt"
+import "bufio"
+import "container/hashmap"
+import "io/ioutil"
+import "os"
+import "path"
+
+// SyncPolicy says when a Map fsyncs its log. Until it does,
+// an OS crash or power loss can take the latest changes
+// along; a crash of just the program can't.
+type SyncPolicy int
+
+const (
+	SyncAlways	SyncPolicy = iota // after every change
+	SyncBatch	// after every Options.BatchSize changes
+	SyncNever	// only on Sync, Compact and Close
+)
+
+type Options struct {
+	Sync		SyncPolicy
+	BatchSize	int // with SyncBatch
+	// Compact before the change that would make the log
+	// longer than this many records; 0 leaves compacting to
+	// the caller.
+	CompactAfter	int
+}
+
+// ErrCorrupt is returned by Open if the snapshot doesn't
+// check out. Unlike the log it is never written in place, so
+// a crash can't tear it.
+var ErrCorrupt = os.NewError("durable: corrupt snapshot")
+
+const logName = "log"
+const snapshotName = "snapshot"
+
+// Map is a map from strings to []byte in a directory of its
+// own. Changes return the error, if any, from writing the
+// log; a change that fails didn't happen.
+type Map struct {
+	m		hashmap.HashMap // hashmap.String -> []byte
+	dir		string
+	opts		Options
+	log		*os.File
+	size		int64 // of the log
+	records		int // in the log
+	unsynced	int
+}
+
+// Open loads the Map kept in dir, which has to exist, or
+// starts an empty one. Replaying the log stops at the first
+// record that is torn or otherwise broken; it and anything
+// after it are cut off. opts may be nil for SyncAlways and
+// no automatic compaction.
+func Open(dir string, opts *Options) (*Map, os.Error) {
+//	fmt.Printf("Open %s\n", dir)
+	self := new(Map)
+	self.m.Init()
+	self.dir = dir
+	if opts != nil {
+		self.opts = *opts
+	}
+	if err := self.load(); err != nil {
+		return nil, err
+	}
+	return self, nil
+}
+
+func (self *Map) path(name string) string { return path.Join(self.dir, name) }
+
+func notExist(err os.Error) bool {
+	e, ok := err.(*os.PathError)
+	return ok && e.Error == os.ENOENT
+}
+
+func (self *Map) load() os.Error {
+	b, err := ioutil.ReadFile(self.path(snapshotName))
+	switch {
+	case err == nil:
+		if n, _ := self.replay(b); n != len(b) {
+			return ErrCorrupt
+		}
+	case !notExist(err):
+		return err
+	}
+	b, err = ioutil.ReadFile(self.path(logName))
+	if err != nil && !notExist(err) {
+		return err
+	}
+	n, records := self.replay(b)
+	self.log, err = os.Open(self.path(logName), os.O_WRONLY|os.O_CREAT, 0666)
+	if err != nil {
+		return err
+	}
+	if n < len(b) {
+		// cut off the torn tail, or new records would end up
+		// behind it where replay never gets to them
+		if err = self.log.Truncate(int64(n)); err == nil {
+			err = self.log.Sync()
+		}
+		if err != nil {
+			self.log.Close()
+			return err
+		}
+	}
+	self.size = int64(n)
+	self.records = records
+	return nil
+}
+
+// Apply the records at the start of b; returns how many
+// bytes and records that was. Replay takes changes as
+// upserts and deletes: if Compact is interrupted after
+// writing the snapshot, the log repeats changes it already
+// has, and they must come out the same.
+func (self *Map) replay(b []byte) (n, records int) {
+	for n < len(b) {
+		op, key, value, size := decode(b[n:])
+		if size == 0 {
+			break
+		}
+		k := hashmap.String(key)
+		switch {
+		case op != opRemove:
+			// not a slice of b, that would keep all of it
+			// alive and let an append to one value run into
+			// the next record
+			v := clone(value)
+			self.m.Upsert(k, func(old interface{}, exists bool) interface{} { return v })
+		case self.m.Has(k):
+			self.m.Remove(k)
+		}
+		n += size
+		records++
+	}
+	return
+}
+
+// Append a record to the log, syncing as the policy says.
+func (self *Map) write(op byte, key string, value []byte) os.Error {
+	if self.opts.CompactAfter > 0 && self.records >= self.opts.CompactAfter {
+		if err := self.Compact(); err != nil {
+			return err
+		}
+	}
+	rec := encode(op, key, value)
+	_, err := self.log.WriteAt(rec, self.size)
+	if err == nil {
+		self.unsynced++
+		if self.opts.Sync == SyncAlways || self.opts.Sync == SyncBatch && self.unsynced >= self.opts.BatchSize {
+			err = self.Sync()
+		}
+	}
+	if err != nil {
+		// don't leave any of the record behind
+		self.log.Truncate(self.size)
+		return err
+	}
+	self.size += int64(len(rec))
+	self.records++
+	return nil
+}
+
+func clone(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
+func (self *Map) Insert(key string, value []byte) os.Error {
+//	fmt.Printf("Insert %s->%s\n", key, value)
+	if self.m.Has(hashmap.String(key)) {
+		panic("Map.Insert: duplicate key")
+	}
+	if err := self.write(opInsert, key, value); err != nil {
+		return err
+	}
+	self.m.Insert(hashmap.String(key), clone(value))
+	return nil
+}
+
+func (self *Map) Set(key string, value []byte) os.Error {
+//	fmt.Printf("Set %s->%s\n", key, value)
+	if !self.m.Has(hashmap.String(key)) {
+		panic("Map.Set: key not found")
+	}
+	if err := self.write(opSet, key, value); err != nil {
+		return err
+	}
+	self.m.Set(hashmap.String(key), clone(value))
+	return nil
+}
+
+func (self *Map) Remove(key string) os.Error {
+//	fmt.Printf("Remove %s\n", key)
+	if !self.m.Has(hashmap.String(key)) {
+		panic("Map.Remove: key not found")
+	}
+	if err := self.write(opRemove, key, nil); err != nil {
+		return err
+	}
+	self.m.Remove(hashmap.String(key))
+	return nil
+}
+
+// At returns the value for key; don't change its bytes.
+func (self *Map) At(key string) []byte {
+//	fmt.Printf("At %s\n", key)
+	return self.m.At(hashmap.String(key)).([]byte)
+}
+
+func (self *Map) Has(key string) bool {
+//	fmt.Printf("Has %s\n", key)
+	return self.m.Has(hashmap.String(key))
+}
+
+func (self *Map) Len() int {
+//	fmt.Printf("Len %d\n", self.m.Len())
+	return self.m.Len()
+}
+
+func (self *Map) Do(f func(key string, value []byte)) {
+//	fmt.Printf("Do %s\n", f)
+	self.m.Do(func(key hashmap.Hashable, value interface{}) {
+		f(string(key.(hashmap.String)), value.([]byte))
+	})
+}
+
+// Sync fsyncs the log.
+func (self *Map) Sync() os.Error {
+//	fmt.Printf("Sync\n")
+	if self.unsynced == 0 {
+		return nil
+	}
+	if err := self.log.Sync(); err != nil {
+		return err
+	}
+	self.unsynced = 0
+	return nil
+}
+
+// Make a rename in the directory durable.
+func (self *Map) syncDir() os.Error {
+	d, err := os.Open(self.dir, os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	err = d.Sync()
+	if e := d.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// Compact replaces the snapshot by the current contents and
+// empties the log. The new snapshot is written next to the
+// old one and renamed over it, so a crash leaves one or the
+// other.
+func (self *Map) Compact() os.Error {
+//	fmt.Printf("Compact\n")
+	tmp := self.path(snapshotName + ".tmp")
+	f, err := os.Open(tmp, os.O_WRONLY|os.O_CREAT|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	self.m.Do(func(key hashmap.Hashable, value interface{}) {
+		if err == nil {
+			_, err = w.Write(encode(opInsert, string(key.(hashmap.String)), value.([]byte)))
+		}
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp, self.path(snapshotName))
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err = self.syncDir(); err != nil {
+		return err
+	}
+	// a crash before this leaves the old log behind, which
+	// replay takes care of
+	if err = self.log.Truncate(0); err == nil {
+		err = self.log.Sync()
+	}
+	if err != nil {
+		return err
+	}
+	self.size = 0
+	self.records = 0
+	self.unsynced = 0
+	return nil
+}
+
+// Close syncs and closes the log; the Map can't be used
+// after that.
+func (self *Map) Close() os.Error {
+//	fmt.Printf("Close\n")
+	err := self.Sync()
+	if e := self.log.Close(); err == nil {
+		err = e
+	}
+	self.log = nil
+	return err
+}
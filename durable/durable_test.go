@@ -0,0 +1,251 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package durable
+
+import "bytes"
+import "io/ioutil"
+import "os"
+import "path"
+import "strconv"
+import "testing"
+
+// An empty directory for a test's Map.
+func testDir(t *testing.T, name string) string {
+	dir := path.Join("_test", name)
+	os.RemoveAll(dir)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatalf("can't make %s: %s", dir, err)
+	}
+	return dir
+}
+
+func open(t *testing.T, dir string, opts *Options) *Map {
+	m, err := Open(dir, opts)
+	if err != nil {
+		t.Fatalf("Open %s: %s", dir, err)
+	}
+	return m
+}
+
+// What the Map should hold.
+type state map[string]string
+
+func (self state) copy() state {
+	c := make(state)
+	for k, v := range self {
+		c[k] = v
+	}
+	return c
+}
+
+func (self state) check(t *testing.T, what string, m *Map) {
+	if m.Len() != len(self) {
+		t.Errorf("%s: expected %d pairs, got %d", what, len(self), m.Len())
+	}
+	for k, v := range self {
+		if !m.Has(k) || !bytes.Equal(m.At(k), []byte(v)) {
+			t.Errorf("%s: expected %s->%s", what, k, v)
+			return
+		}
+	}
+}
+
+// Run a mix of changes on m. Returns the state and the log
+// size after each of them, starting with none.
+func changes(t *testing.T, m *Map, n int) (states []state, sizes []int64) {
+	states = make([]state, 0, 2*n+1)
+	sizes = make([]int64, 0, 2*n+1)
+	s := make(state)
+	done := func() {
+		states = states[0 : len(states)+1]
+		states[len(states)-1] = s.copy()
+		sizes = sizes[0 : len(sizes)+1]
+		sizes[len(sizes)-1] = m.size
+	}
+	done()
+	for i := 0; i < n; i++ {
+		k, v := "k"+strconv.Itoa(i), strconv.Itoa(i)
+		if err := m.Insert(k, []byte(v)); err != nil {
+			t.Fatalf("Insert: %s", err)
+		}
+		s[k] = v
+		done()
+		switch k = "k" + strconv.Itoa(i/2); i % 3 {
+		case 1:
+			if err := m.Set(k, []byte("x"+v)); err != nil {
+				t.Fatalf("Set: %s", err)
+			}
+			s[k] = "x" + v
+			done()
+		case 2:
+			if _, ok := s[k]; ok {
+				if err := m.Remove(k); err != nil {
+					t.Fatalf("Remove: %s", err)
+				}
+				s[k] = "", false
+				done()
+			}
+		}
+	}
+	return
+}
+
+func TestReopen(t *testing.T) {
+	dir := testDir(t, "reopen")
+	for _, p := range []SyncPolicy{SyncAlways, SyncBatch, SyncNever} {
+		os.Remove(path.Join(dir, logName))
+		m := open(t, dir, &Options{Sync: p, BatchSize: 7})
+		states, _ := changes(t, m, 100)
+		last := states[len(states)-1]
+		last.check(t, "before Close", m)
+		if err := m.Close(); err != nil {
+			t.Fatalf("Close: %s", err)
+		}
+		m = open(t, dir, nil)
+		last.check(t, "after Open", m)
+		m.Close()
+	}
+}
+
+// Values read back from the log don't share memory: writing
+// past the end of one, as an append would, leaves the next
+// one alone.
+func TestReopenValuesApart(t *testing.T) {
+	dir := testDir(t, "apart")
+	m := open(t, dir, nil)
+	m.Insert("a", []byte("1"))
+	m.Insert("b", []byte("2"))
+	if err := m.Close(); err != nil {
+		t.Fatalf("Close: %s", err)
+	}
+	m = open(t, dir, nil)
+	a := m.At("a")
+	a = a[0:cap(a)]
+	for i := 1; i < len(a); i++ {
+		a[i] = 'x'
+	}
+	if string(m.At("a")) != "1" || string(m.At("b")) != "2" {
+		t.Errorf("expected a->1 and b->2, got a->%s and b->%s", m.At("a"), m.At("b"))
+	}
+	m.Close()
+}
+
+// Cutting the log anywhere, as a crash could, loses just the
+// changes whose records didn't make it whole.
+func TestTornLog(t *testing.T) {
+	dir := testDir(t, "torn")
+	m := open(t, dir, nil)
+	states, sizes := changes(t, m, 20)
+	m.Close()
+	log, err := ioutil.ReadFile(path.Join(dir, logName))
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	crash := testDir(t, "torn-crash")
+	i := 0
+	for cut := 0; cut <= len(log); cut++ {
+		for i+1 < len(sizes) && sizes[i+1] <= int64(cut) {
+			i++
+		}
+		if err = ioutil.WriteFile(path.Join(crash, logName), log[0:cut], 0666); err != nil {
+			t.Fatalf("WriteFile: %s", err)
+		}
+		m = open(t, crash, nil)
+		what := "cut at " + strconv.Itoa(cut)
+		states[i].check(t, what, m)
+		if b, _ := ioutil.ReadFile(path.Join(crash, logName)); len(b) != int(sizes[i]) {
+			t.Errorf("%s: expected the log cut to %d, got %d", what, sizes[i], len(b))
+		}
+		// what comes next has to survive the next Open
+		m.Insert("new", []byte("new"))
+		m.Close()
+		m = open(t, crash, nil)
+		if !m.Has("new") || m.Len() != len(states[i])+1 {
+			t.Errorf("%s: lost a change made after recovery", what)
+		}
+		m.Close()
+	}
+}
+
+// A flipped bit ends replay just like a torn record does.
+func TestCorruptLog(t *testing.T) {
+	dir := testDir(t, "corrupt")
+	m := open(t, dir, nil)
+	states, sizes := changes(t, m, 20)
+	m.Close()
+	name := path.Join(dir, logName)
+	log, _ := ioutil.ReadFile(name)
+	for _, i := range []int{0, 5, len(sizes) / 2, len(sizes) - 2} {
+		bad := make([]byte, len(log))
+		copy(bad, log)
+		bad[sizes[i]+headerSize+1] ^= 0x10 // in the key
+		ioutil.WriteFile(name, bad, 0666)
+		m = open(t, dir, nil)
+		states[i].check(t, "bit flipped in record "+strconv.Itoa(i), m)
+		m.Close()
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dir := testDir(t, "compact")
+	m := open(t, dir, nil)
+	states, _ := changes(t, m, 50)
+	if err := m.Compact(); err != nil {
+		t.Fatalf("Compact: %s", err)
+	}
+	if m.size != 0 || m.records != 0 {
+		t.Errorf("expected an empty log after Compact, got %d bytes", m.size)
+	}
+	m.Insert("new", []byte("new"))
+	m.Close()
+	last := states[len(states)-1].copy()
+	last["new"] = "new"
+	m = open(t, dir, nil)
+	last.check(t, "after Compact", m)
+	m.Close()
+}
+
+// A crash in Compact after the snapshot is in place but
+// before the log is emptied replays the log a second time.
+func TestCompactCrash(t *testing.T) {
+	dir := testDir(t, "compact-crash")
+	m := open(t, dir, nil)
+	states, _ := changes(t, m, 50)
+	name := path.Join(dir, logName)
+	log, _ := ioutil.ReadFile(name)
+	m.Compact()
+	m.Close()
+	ioutil.WriteFile(name, log, 0666)
+	m = open(t, dir, nil)
+	states[len(states)-1].check(t, "log replayed over its snapshot", m)
+	m.Close()
+}
+
+func TestCompactAfter(t *testing.T) {
+	dir := testDir(t, "compact-after")
+	m := open(t, dir, &Options{CompactAfter: 10})
+	states, _ := changes(t, m, 100)
+	if m.records > 10 {
+		t.Errorf("expected at most 10 records in the log, got %d", m.records)
+	}
+	m.Close()
+	m = open(t, dir, nil)
+	states[len(states)-1].check(t, "after automatic compaction", m)
+	m.Close()
+}
+
+func TestCorruptSnapshot(t *testing.T) {
+	dir := testDir(t, "bad-snapshot")
+	m := open(t, dir, nil)
+	changes(t, m, 10)
+	m.Compact()
+	m.Close()
+	name := path.Join(dir, snapshotName)
+	b, _ := ioutil.ReadFile(name)
+	ioutil.WriteFile(name, b[0:len(b)-1], 0666)
+	if _, err := Open(dir, nil); err != ErrCorrupt {
+		t.Errorf("expected ErrCorrupt, got %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package durable
+
+import "encoding/binary"
+import "hash/crc32"
+
+// Log and snapshot are both a sequence of records framed as
+//
+//	crc	uint32	// CRC-32 (IEEE) of the rest of the record
+//	size	uint32	// of the body, which is
+//	op	byte
+//	klen	uint32
+//	key	[klen]byte
+//	value	[size-5-klen]byte
+//
+// all little endian. A crash can leave the last record of the
+// log torn; its size or CRC won't check out and replay stops
+// right before it.
+const (
+	opInsert	= 1 + iota
+	opSet
+	opRemove
+)
+
+const headerSize = 8
+const bodyHeaderSize = 5
+
+func encode(op byte, key string, value []byte) []byte {
+	size := bodyHeaderSize + len(key) + len(value)
+	b := make([]byte, headerSize+size)
+	binary.LittleEndian.PutUint32(b[4:8], uint32(size))
+	b[8] = op
+	binary.LittleEndian.PutUint32(b[9:13], uint32(len(key)))
+	copy(b[13:], key)
+	copy(b[13+len(key):], value)
+	binary.LittleEndian.PutUint32(b[0:4], crc32.ChecksumIEEE(b[4:]))
+	return b
+}
+
+// Decode the record at the start of b. n is its length, or 0
+// if b doesn't start with a whole, intact record. value
+// points into b.
+func decode(b []byte) (op byte, key string, value []byte, n int) {
+	if len(b) < headerSize {
+		return
+	}
+	size := binary.LittleEndian.Uint32(b[4:8])
+	if size < bodyHeaderSize || uint64(size) > uint64(len(b)-headerSize) {
+		return
+	}
+	rec := b[0 : headerSize+int(size)]
+	if crc32.ChecksumIEEE(rec[4:]) != binary.LittleEndian.Uint32(rec[0:4]) {
+		return
+	}
+	klen := binary.LittleEndian.Uint32(rec[9:13])
+	if uint64(klen) > uint64(size-bodyHeaderSize) || rec[8] < opInsert || rec[8] > opRemove {
+		return
+	}
+	return rec[8], string(rec[13 : 13+klen]), rec[13+klen:], len(rec)
+}
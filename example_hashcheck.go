@@ -0,0 +1,46 @@
+package main
+
+import "container/hashmap/hashcheck"
+import "fmt"
+import "io/ioutil"
+import "os"
+import "strings"
+
+// The two hashes from example_hashmap.go.
+
+type String string
+
+func (self String) Hash() uint {
+	var h uint = 5381
+	for _, r := range self {
+		h = (h << 5) + h + uint(r)
+	}
+	return h
+}
+
+type silly string
+
+func (self silly) Hash() uint {
+	var h uint
+	for _, r := range self {
+		h = h + uint(r)
+	}
+	return h
+}
+
+func main() {
+	raw, error := ioutil.ReadFile("/usr/share/dict/cracklib-words")
+	if error == nil {
+		words := strings.Split(string(raw), "\n", 0)
+
+		fmt.Printf("String.Hash\n")
+		hashcheck.Check(words, func(w string) hashcheck.Hasher {
+			return String(w)
+		}).Write(os.Stdout)
+
+		fmt.Printf("\nsillyHash\n")
+		hashcheck.Check(words, func(w string) hashcheck.Hasher {
+			return silly(w)
+		}).Write(os.Stdout)
+	}
+}
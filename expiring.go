@@ -0,0 +1,241 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "io"
+import "sync"
+import "time"
+
+// Clock tells an ExpiringMap what time it is. Tests can
+// substitute their own to avoid sleeping.
+type Clock interface {
+	// Now returns the current time in nanoseconds.
+	Now() int64
+	// After returns a channel that receives once ns
+	// nanoseconds have passed.
+	After(ns int64) <-chan int64
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() int64 { return time.Nanoseconds() }
+func (systemClock) After(ns int64) <-chan int64 { return time.After(ns) }
+
+// SystemClock is the Clock backed by the time package.
+var SystemClock Clock = systemClock{}
+
+// Values in an ExpiringMap are wrapped with their deadline.
+// Any deadline is one a clock can read, so pairs that never
+// expire say so apart.
+type expiring struct {
+	value		interface{}
+	deadline	int64 // unless forever
+	forever		bool
+}
+
+func (self *expiring) expired(now int64) bool {
+	return !self.forever && self.deadline <= now
+}
+
+// ExpiringMap is a HashMap whose pairs can expire. Expired
+// pairs are treated as absent and are collected lazily when
+// they are looked up, by Sweep(), or by a background sweeper.
+// It is safe for concurrent use.
+// You must call Init() before using it.
+type ExpiringMap struct {
+	lock	sync.Mutex
+	m	HashMap
+	clock	Clock
+	quit	chan bool // non-nil while the sweeper runs
+	done	chan bool
+}
+
+// Init initializes or clears an ExpiringMap, a nil clock
+// means SystemClock.
+func (self *ExpiringMap) Init(clock Clock) *ExpiringMap {
+	if clock == nil {
+		clock = SystemClock
+	}
+	self.m.Init()
+	self.clock = clock
+	return self
+}
+
+// NewExpiring returns an initialized ExpiringMap.
+func NewExpiring(clock Clock) *ExpiringMap {
+	return new(ExpiringMap).Init(clock)
+}
+
+// Look up the live entry for key, removing it if expired;
+// must hold the lock.
+func (self *ExpiringMap) live(key Hashable) *expiring {
+	if !self.m.Has(key) {
+		return nil
+	}
+	e := self.m.At(key).(*expiring)
+	if e.expired(self.clock.Now()) {
+		self.m.Remove(key)
+		return nil
+	}
+	return e
+}
+
+// Insert adds a pair that never expires.
+func (self *ExpiringMap) Insert(key Hashable, value interface{}) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.live(key) != nil {
+		panic("ExpiringMap.Insert: duplicate key")
+	}
+	self.m.Insert(key, &expiring{value, 0, true})
+}
+
+// SetWithTTL adds or replaces the pair for key so that it
+// expires ns nanoseconds from now.
+func (self *ExpiringMap) SetWithTTL(key Hashable, value interface{}, ns int64) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	deadline := self.clock.Now() + ns
+	if e := self.live(key); e != nil {
+		e.value = value
+		e.deadline = deadline
+		e.forever = false
+		return
+	}
+	self.m.Insert(key, &expiring{value, deadline, false})
+}
+
+// Set replaces the value for key, keeping its deadline.
+func (self *ExpiringMap) Set(key Hashable, value interface{}) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	e := self.live(key)
+	if e == nil {
+		panic("ExpiringMap.Set: key not found")
+	}
+	e.value = value
+}
+
+func (self *ExpiringMap) Remove(key Hashable) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.live(key) == nil {
+		panic("ExpiringMap.Remove: key not found")
+	}
+	self.m.Remove(key)
+}
+
+func (self *ExpiringMap) At(key Hashable) interface{} {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	e := self.live(key)
+	if e == nil {
+		panic("ExpiringMap.At: key not found")
+	}
+	return e.value
+}
+
+func (self *ExpiringMap) Has(key Hashable) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.live(key) != nil
+}
+
+// Len counts pairs that have expired but not been collected
+// yet; call Sweep() first for an exact count.
+func (self *ExpiringMap) Len() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.m.Len()
+}
+
+// Stats describes the underlying HashMap, which like Len
+// counts pairs that have expired but not been collected.
+func (self *ExpiringMap) Stats() Stats {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.m.Stats()
+}
+
+// Dump writes the chains of the underlying HashMap to w.
+func (self *ExpiringMap) Dump(w io.Writer) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.m.Dump(w)
+}
+
+// Do calls f for every pair that has not expired. The map
+// is locked during the call, f must not use it.
+func (self *ExpiringMap) Do(f func(key Hashable, value interface{})) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	now := self.clock.Now()
+	self.m.Do(func(key Hashable, value interface{}) {
+		e := value.(*expiring)
+		if !e.expired(now) {
+			f(key, e.value)
+		}
+	})
+}
+
+// Sweep removes all expired pairs and returns how many
+// there were.
+func (self *ExpiringMap) Sweep() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	now := self.clock.Now()
+	// can't remove while iterating, Remove may shrink
+	dead := make([]Hashable, self.m.Len())
+	n := 0
+	self.m.Do(func(key Hashable, value interface{}) {
+		e := value.(*expiring)
+		if e.expired(now) {
+			dead[n] = key
+			n++
+		}
+	})
+	for _, key := range dead[0:n] {
+		self.m.Remove(key)
+	}
+	return n
+}
+
+func (self *ExpiringMap) sweeper(interval int64, quit <-chan bool, done chan<- bool) {
+	for {
+		select {
+		case <-quit:
+			done <- true
+			return
+		case <-self.clock.After(interval):
+			self.Sweep()
+		}
+	}
+}
+
+// StartSweeper starts a goroutine that calls Sweep() every
+// interval nanoseconds until Close() is called.
+func (self *ExpiringMap) StartSweeper(interval int64) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.quit != nil {
+		panic("ExpiringMap.StartSweeper: already running")
+	}
+	self.quit = make(chan bool)
+	self.done = make(chan bool)
+	go self.sweeper(interval, self.quit, self.done)
+}
+
+// Close stops the background sweeper, if any, and waits
+// for it to finish.
+func (self *ExpiringMap) Close() {
+	self.lock.Lock()
+	quit, done := self.quit, self.done
+	self.quit, self.done = nil, nil
+	self.lock.Unlock()
+	if quit != nil {
+		quit <- true
+		<-done
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "testing"
+
+// A Clock that only moves when told to. Every call to After
+// is announced on waiting so tests can tell when a sweeper
+// is idle again.
+type fakeClock struct {
+	now	int64
+	timer	chan int64
+	at	int64
+	waiting	chan bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{waiting: make(chan bool, 1)}
+}
+
+func (self *fakeClock) Now() int64 { return self.now }
+
+func (self *fakeClock) After(ns int64) <-chan int64 {
+	t := make(chan int64)
+	self.timer = t
+	self.at = self.now + ns
+	self.waiting <- true
+	return t
+}
+
+func (self *fakeClock) Advance(ns int64) {
+	self.now += ns
+	if self.timer != nil && self.at <= self.now {
+		t := self.timer
+		self.timer = nil
+		t <- self.now
+	}
+}
+
+func TestExpiringLazy(t *testing.T) {
+	const Len = 100
+	c := newFakeClock()
+	m := NewExpiring(c)
+	for i := 0; i < Len; i++ {
+		m.SetWithTTL(Integer(i), i, int64(i+1))
+	}
+	m.Insert(Integer(Len), Len)
+	c.Advance(Len / 2)
+	for i := 0; i < Len; i++ {
+		if m.Has(Integer(i)) != (i >= Len/2) {
+			t.Errorf("%d expired at the wrong time", i)
+		}
+	}
+	// lookups collected the expired pairs
+	if m.Len() != Len/2+1 {
+		t.Errorf("expected %d, got %d", Len/2+1, m.Len())
+	}
+	c.Advance(Len)
+	if !m.Has(Integer(Len)) {
+		t.Errorf("pair without ttl expired")
+	}
+}
+
+func TestExpiringRenew(t *testing.T) {
+	c := newFakeClock()
+	m := NewExpiring(c)
+	m.SetWithTTL(Integer(1), "a", 10)
+	c.Advance(5)
+	m.SetWithTTL(Integer(1), "b", 10)
+	c.Advance(5)
+	if v := m.At(Integer(1)); v != "b" {
+		t.Errorf("expected b, got %v", v)
+	}
+	c.Advance(5)
+	if m.Has(Integer(1)) {
+		t.Errorf("renewed pair did not expire")
+	}
+}
+
+// A deadline can be anything the clock reads, 0 too.
+func TestExpiringAtZero(t *testing.T) {
+	c := newFakeClock()
+	m := NewExpiring(c)
+	m.SetWithTTL(Integer(1), 1, 0)
+	m.Insert(Integer(2), 2)
+	m.SetWithTTL(Integer(2), 2, 0) // no longer forever
+	if m.Has(Integer(1)) || m.Has(Integer(2)) {
+		t.Errorf("pairs with a deadline of 0 didn't expire at 0")
+	}
+	m.Insert(Integer(3), 3)
+	if !m.Has(Integer(3)) || m.Sweep() != 0 {
+		t.Errorf("pair without ttl expired")
+	}
+}
+
+func TestExpiringSweeper(t *testing.T) {
+	const Len = 100
+	c := newFakeClock()
+	m := NewExpiring(c)
+	for i := 0; i < Len; i++ {
+		m.SetWithTTL(Integer(i), i, 10)
+	}
+	m.StartSweeper(100)
+	<-c.waiting
+	c.Advance(50)
+	if m.Len() != Len {
+		t.Errorf("swept before the interval, %d left", m.Len())
+	}
+	c.Advance(50)
+	<-c.waiting
+	if m.Len() != 0 {
+		t.Errorf("expected 0 after sweep, got %d", m.Len())
+	}
+	m.Close()
+}
+
+// Stats count expired pairs until they are collected, like
+// Len does.
+func TestExpiringStats(t *testing.T) {
+	const Len = 100
+	c := newFakeClock()
+	m := NewExpiring(c)
+	for i := 0; i < Len; i++ {
+		m.SetWithTTL(Integer(i), i, 1)
+	}
+	c.Advance(1)
+	if s := m.Stats(); s.Entries != Len || s.Grows == 0 {
+		t.Errorf("expected %d entries before the sweep, got %v", Len, s)
+	}
+	m.Sweep()
+	if s := m.Stats(); s.Entries != 0 {
+		t.Errorf("expected no entries after the sweep, got %v", s)
+	}
+}
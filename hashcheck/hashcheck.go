@@ -0,0 +1,231 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The hashcheck package judges the Hash() methods of keys
+// for container/hashmap. Give it a corpus of words and a
+// function turning a word into a key; it reports how often
+// hashes collide, how evenly they spread over tables of
+// various sizes, and how well flipping one input bit flips
+// the output bits (avalanche).
+package hashcheck
+
+import "container/hashmap/sizing"
+import "fmt"
+import "io"
+import "math"
+import "unsafe"
+
+// Hasher is all hashcheck needs from a key; every Hashable
+// of container/hashmap and container/hashmap/open is one.
+type Hasher interface {
+	Hash() uint
+}
+
+// Bits in a hash.
+const hashBits = uint(unsafe.Sizeof(uint(0))) * 8
+
+// Words used for the avalanche test, it's quadratic-ish.
+const avalancheWords = 1000
+
+// Table sizes: powers of two as in hashmap.go, and primes
+// as in open/hashmap.go.
+var policies = []sizing.SizePolicy{
+	sizing.PowerOfTwo,
+	sizing.PrimesNearPowers,
+}
+
+// TableReport describes how the hashes spread over a table
+// of Size buckets using Hash() % Size.
+type TableReport struct {
+	Size		uint
+	PowerOfTwo	bool
+	// Pearson's chi-squared statistic against a uniform
+	// spread; about Size-1 for a good hash.
+	ChiSquared	float
+	// Standard deviations ChiSquared is above Size-1.
+	Deviation	float
+	Empty		uint // buckets without a key
+	WorstChain	int
+}
+
+// Report is the result of Check.
+type Report struct {
+	Keys		int // distinct words in the corpus
+	Collisions	int // keys sharing their full hash with another
+	// Mean fraction of hash bits that flip when one input
+	// bit flips, ideally 0.5.
+	Avalanche	float
+	// Largest distance of any single hash bit's flip rate
+	// from 0.5, ideally close to 0.
+	AvalancheBias	float
+	Tables		[]TableReport
+	Warnings	[]string
+}
+
+// Check hashes every distinct word of the corpus as key(word).
+func Check(corpus []string, key func(word string) Hasher) *Report {
+	r := new(Report)
+
+	seen := make(map[string]bool)
+	words := make([]string, len(corpus))
+	for _, w := range corpus {
+		if !seen[w] {
+			seen[w] = true
+			words[r.Keys] = w
+			r.Keys++
+		}
+	}
+	words = words[0:r.Keys]
+
+	hashes := make([]uint, r.Keys)
+	distinct := make(map[uint]int)
+	for i, w := range words {
+		h := key(w).Hash()
+		hashes[i] = h
+		distinct[h]++
+	}
+	for _, n := range distinct {
+		if n > 1 {
+			r.Collisions += n
+		}
+	}
+
+	r.avalanche(words, key)
+
+	for _, size := range sizes(r.Keys) {
+		r.Tables = addTable(r.Tables, table(hashes, size))
+	}
+
+	r.warn()
+	return r
+}
+
+// Sizes of every policy from the initial one up to the
+// first one past twice the keys.
+func sizes(keys int) []uint {
+	n := 0
+	s := make([]uint, len(policies)*64)
+	limit := uint64(2 * keys)
+	for _, p := range policies {
+		for x := p.Initial(); x != 0; x = p.Grow(x) {
+			s[n] = uint(x)
+			n++
+			if x >= limit {
+				break
+			}
+		}
+	}
+	return s[0:n]
+}
+
+func addTable(t []TableReport, x TableReport) []TableReport {
+	n := make([]TableReport, len(t)+1)
+	copy(n, t)
+	n[len(t)] = x
+	return n
+}
+
+func table(hashes []uint, size uint) (t TableReport) {
+	t.Size = size
+	t.PowerOfTwo = size&(size-1) == 0
+	counts := make([]int, size)
+	for _, h := range hashes {
+		counts[h%size]++
+	}
+	expected := float(len(hashes)) / float(size)
+	for _, c := range counts {
+		if c == 0 {
+			t.Empty++
+		}
+		if c > t.WorstChain {
+			t.WorstChain = c
+		}
+		d := float(c) - expected
+		t.ChiSquared += d * d / expected
+	}
+	df := float(size - 1)
+	t.Deviation = (t.ChiSquared - df) / float(math.Sqrt(float64(2*df)))
+	return
+}
+
+func (self *Report) avalanche(words []string, key func(word string) Hasher) {
+	if len(words) > avalancheWords {
+		words = words[0:avalancheWords]
+	}
+	flips := make([]int, hashBits)
+	trials := 0
+	for _, w := range words {
+		h := key(w).Hash()
+		b := []byte(w)
+		for i := range b {
+			for bit := uint(0); bit < 8; bit++ {
+				b[i] ^= 1 << bit
+				x := h ^ key(string(b)).Hash()
+				b[i] ^= 1 << bit
+				for j := uint(0); j < hashBits; j++ {
+					flips[j] += int(x >> j & 1)
+				}
+				trials++
+			}
+		}
+	}
+	if trials == 0 {
+		return
+	}
+	total := 0
+	for _, f := range flips {
+		total += f
+		bias := math.Fabs(float64(f)/float64(trials) - 0.5)
+		if float(bias) > self.AvalancheBias {
+			self.AvalancheBias = float(bias)
+		}
+	}
+	self.Avalanche = float(total) / float(trials*int(hashBits))
+}
+
+// Thresholds for warnings.
+const (
+	maxDeviation		= 4	// chi-squared sigmas
+	minAvalanche		= 0.4
+	maxAvalancheBias	= 0.1
+)
+
+func (self *Report) warn() {
+	var w []string
+	add := func(s string) {
+		x := make([]string, len(w)+1)
+		copy(x, w)
+		x[len(w)] = s
+		w = x
+	}
+	if self.Collisions > 0 {
+		add(fmt.Sprintf("%d of %d keys share their full hash", self.Collisions, self.Keys))
+	}
+	if self.Avalanche < minAvalanche {
+		add(fmt.Sprintf("flipping an input bit flips only %.1f%% of hash bits", 100*self.Avalanche))
+	}
+	if self.AvalancheBias > maxAvalancheBias {
+		add(fmt.Sprintf("some hash bit flips with probability %.2f, not 0.5", 0.5+self.AvalancheBias))
+	}
+	for _, t := range self.Tables {
+		if t.Deviation > maxDeviation {
+			add(fmt.Sprintf("clusters in %d buckets: chi-squared %.0f, %.1f sigmas above uniform, worst chain %d",
+				t.Size, t.ChiSquared, t.Deviation, t.WorstChain))
+		}
+	}
+	self.Warnings = w
+}
+
+// Write prints the report in a table to w.
+func (self *Report) Write(w io.Writer) {
+	fmt.Fprintf(w, "%d keys, %d colliding, avalanche %.3f (bias %.3f)\n",
+		self.Keys, self.Collisions, self.Avalanche, self.AvalancheBias)
+	fmt.Fprintf(w, "%12s %12s %8s %10s %6s\n", "size", "chi2", "sigmas", "empty", "worst")
+	for _, t := range self.Tables {
+		fmt.Fprintf(w, "%12d %12.0f %8.1f %10d %6d\n", t.Size, t.ChiSquared, t.Deviation, t.Empty, t.WorstChain)
+	}
+	for _, s := range self.Warnings {
+		fmt.Fprintf(w, "warning: %s\n", s)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashcheck
+
+import "fmt"
+import "strconv"
+import "testing"
+
+// Integer hashes like the one in container/hashmap's tests.
+type Integer int
+
+func (self Integer) Hash() uint { return uint(self*self) }
+
+// Sums runes like sillyHash in example_hashmap.go.
+type silly string
+
+func (self silly) Hash() uint {
+	var h uint
+	for _, r := range self {
+		h = h + uint(r)
+	}
+	return h
+}
+
+// FNV-1a with a final mix, should pass everything.
+type good string
+
+func (self good) Hash() uint {
+	var h uint64 = 14695981039346656037
+	for i := 0; i < len(self); i++ {
+		h ^= uint64(self[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return uint(h)
+}
+
+func corpus(n int) []string {
+	c := make([]string, n)
+	for i := range c {
+		c[i] = fmt.Sprintf("%d", i)
+	}
+	return c
+}
+
+func TestSquaresWarn(t *testing.T) {
+	r := Check(corpus(10000), func(w string) Hasher {
+		i, _ := strconv.Atoi(w)
+		return Integer(i)
+	})
+	clustered := false
+	for _, x := range r.Tables {
+		if x.PowerOfTwo && x.Deviation > maxDeviation {
+			clustered = true
+		}
+	}
+	if !clustered || len(r.Warnings) == 0 {
+		t.Errorf("squares not flagged as clustering: %v", r.Warnings)
+	}
+}
+
+func TestSillyWarns(t *testing.T) {
+	r := Check(corpus(10000), func(w string) Hasher { return silly(w) })
+	if r.Collisions == 0 || r.Avalanche >= minAvalanche {
+		t.Errorf("sum of runes not flagged: %d collisions, avalanche %f", r.Collisions, r.Avalanche)
+	}
+}
+
+func TestGoodPasses(t *testing.T) {
+	r := Check(corpus(10000), func(w string) Hasher { return good(w) })
+	if len(r.Warnings) != 0 {
+		t.Errorf("good hash flagged: %v", r.Warnings)
+	}
+	if r.Keys != 10000 || len(r.Tables) == 0 {
+		t.Errorf("expected 10000 keys and some tables, got %d and %d", r.Keys, len(r.Tables))
+	}
+}
@@ -6,12 +6,25 @@
 package hashmap
 
 //import "fmt"
+import "container/hashmap/sizing"
+import "io"
+import "unsafe"
 
 // These seem right, Java's lower 0.75 bound resizes too
 // much, a higher 1.15 or 1.25 bound makes chains grow
 const loadGrow = 1.0
 const loadShrink = 0.25
 
+// Shrink only if the smaller table is at most this fraction
+// of loadGrow full, so the next few inserts don't grow it
+// right back, whatever steps the size policy takes.
+const hysteresis = 0.5
+
+// Maps with up to smallSize pairs keep them in one chain,
+// nodes and all, inside the HashMap itself and find them
+// with Equal alone, without hashing.
+const smallSize = 8
+
 // Hashable is an interface that keys have to implement.
 type Hashable interface {
 	Hash() uint
@@ -22,9 +35,28 @@ type Hashable interface {
 // You must call Init() before using it.
 type HashMap struct {
 	data	[]hashVector // each should be short
+	nodes	slab // all chains live here
 	count	int // to compute load factor
+	small	bool // data is just inline, and unhashed
+	inline	[1]hashVector // the only bucket while small
+	first	[smallSize + 1]slabNode // the first chunk while small, 0 is nil
+	owner	*owner // trees of other owners are shared
+	tableShared	bool // data itself is shared
+	policy	sizing.SizePolicy // table sizes
+	reserved	int // never shrink below room for this many
+	autoShrink	bool
+	grows	int // for Stats()
+	shrinks	int
+	watch	observers
 }
 
+// Delete can be returned from the callbacks of Upsert,
+// ComputeIfAbsent, and ComputeIfPresent to remove the key
+// instead of storing a value.
+var Delete interface{} = new(deleteMarker)
+
+type deleteMarker byte
+
 // HashPair is a key and a value.
 // Iter() yields HashPairs.
 type HashPair struct {
@@ -37,46 +69,250 @@ func (self *HashMap) loadFactor() float {
 	return float(self.count) / float(len(self.data))
 }
 
+// Nodes stay where they are, only their links change.
 func (self *HashMap) rehashInto(data []hashVector) {
 //	fmt.Printf("rehashInto %d\n", len(data))
 	l := uint(len(data))
 	for b := range self.data {
-		if self.data[b].count > 0 && self.data[b].data != nil {
-			for i := 0; i < self.data[b].count; i++ {
-				e := self.data[b].data[i]
-				h := e.Key.Hash() % l
-				data[h].push(e)
-			}
+		for i := self.data[b].head; i != 0; {
+			next := self.nodes.at(i).next
+			h := self.nodes.at(i).pair.Key.Hash() % l
+			data[h].link(&self.nodes, i)
+			i = next
 		}
 	}
 }
 
+// Whether another pair would overload the table.
+func (self *HashMap) full() bool {
+	if self.small {
+		return self.count >= smallSize
+	}
+	return self.loadFactor() >= loadGrow
+}
+
 func (self *HashMap) grow() {
 //	fmt.Printf("grow\n")
-	d := make([]hashVector, len(self.data)*2)
-	self.rehashInto(d)
-	self.data = d
+	if self.small {
+		self.resize(self.tableSize(self.count))
+		return
+	}
+	s := self.policy.Grow(uint64(len(self.data)))
+	if s == 0 {
+		panic("grow: can't grow bigger!")
+	}
+	self.resize(int(s))
 }
 
 func (self *HashMap) shrink() {
 //	fmt.Printf("shrink\n")
-	d := make([]hashVector, len(self.data)/2)
+	if self.small {
+		return
+	}
+	if self.fitsSmall() {
+		self.toSmall()
+		return
+	}
+	s := int(self.policy.Shrink(uint64(len(self.data))))
+	if s < self.tableSize(self.reserved) || float(self.count) >= float(s)*loadGrow*hysteresis {
+		return
+	}
+	self.resize(s)
+}
+
+// Resize to exactly size buckets, rehashing only if that's
+// actually different. A small map always becomes a hashed
+// one.
+func (self *HashMap) resize(size int) {
+//	fmt.Printf("resize %d\n", size)
+	if !self.resizing(size) {
+		return
+	}
+	self.rehash(size)
+	if self.small {
+		self.nodes.moveFirst()
+		self.leaveSmall()
+	}
+}
+
+// Count a resize to size buckets and tell the observers,
+// unless the table has that size already.
+func (self *HashMap) resizing(size int) bool {
+	switch {
+	case size > len(self.data):
+		self.grows++
+	case size < len(self.data):
+		self.shrinks++
+	default:
+		return false
+	}
+	self.watch.resized(len(self.data), size)
+	return true
+}
+
+// The pairs have moved out of the inline vector and the
+// first chunk.
+func (self *HashMap) leaveSmall() {
+	self.small = false
+	self.inline[0] = hashVector{}
+	self.first = [smallSize + 1]slabNode{} // let the GC have them
+}
+
+// Move all pairs into a new table of size buckets, which
+// belongs to this map alone; the nodes stay.
+func (self *HashMap) rehash(size int) {
+	d := make([]hashVector, size)
 	self.rehashInto(d)
+	for b := range d {
+		d[b].owner = self.owner
+	}
 	self.data = d
+	self.tableShared = false
+}
+
+// Make the inline vector the only, empty bucket, and the
+// inline nodes the only chunk.
+func (self *HashMap) initSmall() {
+	self.first = [smallSize + 1]slabNode{}
+	self.nodes.init(self.first[0:])
+	self.inline[0] = hashVector{owner: self.owner}
+	self.data = self.inline[0:]
+	self.tableShared = false
+	self.small = true
+}
+
+// After *self = *from for a small map: point at our own
+// inline bucket and nodes, not at from's.
+func (self *HashMap) rebind() {
+	if self.small {
+		self.data = self.inline[0:]
+		self.nodes.relocate(self.first[0:])
+	}
+}
+
+// Whether the pairs are better off in the inline vector,
+// with the same slack that shrink() leaves.
+func (self *HashMap) fitsSmall() bool {
+	return float(self.count) < smallSize*hysteresis && self.reserved <= smallSize
+}
+
+// Move all pairs into the inline vector.
+func (self *HashMap) toSmall() {
+//	fmt.Printf("toSmall\n")
+	var pairs [smallSize]HashPair
+	n := 0
+	for b := range self.data {
+		for i := self.data[b].head; i != 0; i = self.nodes.at(i).next {
+			pairs[n] = self.nodes.at(i).pair
+			n++
+		}
+	}
+	size := len(self.data)
+	self.initSmall()
+	for i := n - 1; i >= 0; i-- {
+		self.data[0].push(&self.nodes, pairs[i])
+	}
+	self.shrinks++
+	self.watch.resized(size, 1)
+}
+
+// Smallest table that holds n pairs without growing.
+func (self *HashMap) tableSize(n int) int {
+	s := sizing.Fit(self.policy, uint64(n), loadGrow)
+	if s == 0 {
+		panic("tableSize: can't grow bigger!")
+	}
+	return int(s)
+}
+
+// The size to rebuild at: room for the pairs with the same
+// slack that shrink() leaves, and for what was reserved.
+func (self *HashMap) idealSize() int {
+	n := int(float(self.count) / hysteresis)
+	if n < self.reserved {
+		n = self.reserved
+	}
+	return self.tableSize(n)
+}
+
+// Grow the table once so that n more pairs fit.
+func (self *HashMap) presize(n int) {
+	if self.small && self.count+n <= smallSize {
+		return
+	}
+	if s := self.tableSize(self.count + n); s > len(self.data) {
+		self.resize(s)
+	}
 }
 
 func (self *HashMap) find(key Hashable) (bucket int, position int) {
 //	fmt.Printf("find %s\n", key)
+	if self.small {
+		return 0, self.data[0].find(&self.nodes, key)
+	}
 	h := key.Hash() % uint(len(self.data))
-	p := self.data[h].find(key)
+	p := self.data[h].find(&self.nodes, key)
 	return int(h), p
 }
 
-// Init initializes or clears a HashMap.
+// Make bucket b safe to change in place. After Snapshot()
+// the table, the trees and the slab's chunks are shared; the
+// first write to a bucket copies the table (once) and the
+// bucket's tree. The slab copies its chunks by itself.
+func (self *HashMap) own(b int) {
+	if self.tableShared {
+		d := make([]hashVector, len(self.data))
+		copy(d, self.data)
+		self.data = d
+		self.tableShared = false
+	}
+	if v := &self.data[b]; v.owner != self.owner {
+		if v.tree != nil {
+			v.treeify(&self.nodes)
+		}
+		v.owner = self.owner
+	}
+}
+
+// Add a pair for a key that find() didn't find in bucket.
+// The inline vector is never turned into a tree.
+func (self *HashMap) add(bucket int, pair HashPair) {
+	self.own(bucket)
+	if self.small {
+		self.data[0].push(&self.nodes, pair)
+	} else {
+		self.data[bucket].add(&self.nodes, pair)
+	}
+	self.count++
+	self.watch.inserted(pair.Key, pair.Value)
+}
+
+// Init initializes or clears a HashMap, sizing its table
+// in powers of two.
 func (self *HashMap) Init() *HashMap {
-//	fmt.Printf("Init %s\n", self)
-	self.data = make([]hashVector, 8)
+	return self.InitWithPolicy(sizing.PowerOfTwo)
+}
+
+// InitWithPolicy initializes or clears a HashMap that sizes
+// its table according to p.
+func (self *HashMap) InitWithPolicy(p sizing.SizePolicy) *HashMap {
+//	fmt.Printf("InitWithPolicy %s\n", self)
+	self.watch.start()
+	if len(self.watch.list) > 0 {
+		// clearing, the observers see everything go
+		self.Do(func(key Hashable, value interface{}) { self.watch.removed(key, value) })
+		if len(self.data) > 1 {
+			self.watch.resized(len(self.data), 1)
+		}
+	}
+	self.policy = p
+	self.reserved = 0
+	self.autoShrink = true
+	self.initSmall()
 	self.count = 0
+	self.grows = 0
+	self.shrinks = 0
+	self.watch.end()
 	return self
 }
 
@@ -86,53 +322,83 @@ func New() *HashMap {
 	return new(HashMap).Init()
 }
 
+// NewWithPolicy returns an initialized hashmap that sizes
+// its table according to p.
+func NewWithPolicy(p sizing.SizePolicy) *HashMap {
+//	fmt.Printf("NewWithPolicy\n")
+	return new(HashMap).InitWithPolicy(p)
+}
+
 func (self *HashMap) Insert(key Hashable, value interface{}) {
 //	fmt.Printf("Insert %s->%s\n", key, value)
-	if self.loadFactor() >= loadGrow {
-		self.grow()
-	}
-
+	self.watch.start()
 	bucket, position := self.find(key)
 	if position != -1 {
 		panic("HashMap.Insert: duplicate key")
 	}
 
-	self.data[bucket].push(HashPair{key, value})
-	self.count++
+	self.insertAt(bucket, HashPair{key, value})
+	self.watch.end()
 }
 
-func (self *HashMap) Remove(key Hashable) {
-//	fmt.Printf("Remove %s\n", key)
-	bucket, position := self.find(key)
-	if position == -1 {
-		panic("HashMap.Remove: key not found")
+// Push a pair for a key that find() didn't find in bucket.
+func (self *HashMap) insertAt(bucket int, pair HashPair) {
+	if self.full() {
+		self.grow()
+		bucket = int(pair.Key.Hash() % uint(len(self.data)))
 	}
+	self.add(bucket, pair)
+}
 
-	self.data[bucket].pop(position)
+func (self *HashMap) removeAt(bucket int, position int) {
+	self.own(bucket)
+	e := self.nodes.at(position).pair
+	self.data[bucket].pop(&self.nodes, position)
 	self.count--
+	self.watch.removed(e.Key, e.Value)
 
-	if self.loadFactor() <= loadShrink {
+	if self.autoShrink && self.loadFactor() <= loadShrink {
 		self.shrink()
 	}
 }
 
+func (self *HashMap) Remove(key Hashable) {
+//	fmt.Printf("Remove %s\n", key)
+	self.watch.start()
+	bucket, position := self.find(key)
+	if position == -1 {
+		panic("HashMap.Remove: key not found")
+	}
+	self.removeAt(bucket, position)
+	self.watch.end()
+}
+
 func (self *HashMap) At(key Hashable) interface{} {
 //	fmt.Printf("At %s\n", key)
-	bucket, position := self.find(key)
+	_, position := self.find(key)
 	if position == -1 {
 		panic("HashMap.At: key not found")
 	}
-	e := self.data[bucket].data[position]
-	return e.Value
+	return self.nodes.at(position).pair.Value
 }
 
 func (self *HashMap) Set(key Hashable, value interface{}) {
 //	fmt.Printf("Set %s->%s\n", key, value)
-	bucket, position := self.find(key)
+	self.watch.start()
+	_, position := self.find(key)
 	if position == -1 {
 		panic("HashMap.Set: key not found")
 	}
-	self.data[bucket].data[position].Value = value
+	self.update(position, value)
+	self.watch.end()
+}
+
+// Replace the value of the pair at position. Only the node
+// changes, not its bucket.
+func (self *HashMap) update(position int, value interface{}) {
+	e := &self.nodes.write(position).pair
+	self.watch.updated(e.Key, e.Value, value)
+	e.Value = value
 }
 
 func (self *HashMap) Has(key Hashable) bool {
@@ -141,6 +407,193 @@ func (self *HashMap) Has(key Hashable) bool {
 	return position != -1
 }
 
+// Lookup returns the value for key, with ok false if there
+// is none; it's At and Has in one.
+func (self *HashMap) Lookup(key Hashable) (value interface{}, ok bool) {
+//	fmt.Printf("Lookup %s\n", key)
+	_, position := self.find(key)
+	if position == -1 {
+		return nil, false
+	}
+	return self.nodes.at(position).pair.Value, true
+}
+
+// The bucket a key with hash would be in.
+func (self *HashMap) bucketFor(hash uint) *hashVector {
+	if self.small {
+		return &self.data[0]
+	}
+	return &self.data[hash%uint(len(self.data))]
+}
+
+// LookupWith finds a key without having it as a Hashable:
+// hash must be what the key's Hash() would return, and eq
+// must be true for the key and for no other. Trees are
+// searched linearly.
+func (self *HashMap) LookupWith(hash uint, eq func(key Hashable) bool) (value interface{}, ok bool) {
+//	fmt.Printf("LookupWith %d\n", hash)
+	v := self.bucketFor(hash)
+	for i := v.head; i != 0; i = self.nodes.at(i).next {
+		if e := &self.nodes.at(i).pair; eq(e.Key) {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Find the pair whose key is the String with the bytes b.
+func (self *HashMap) findBytes(b []byte) *HashPair {
+	v := self.bucketFor(HashBytes(b))
+	for i := v.head; i != 0; i = self.nodes.at(i).next {
+		e := &self.nodes.at(i).pair
+		if s, ok := e.Key.(String); ok && string(s) == string(b) {
+			return e
+		}
+	}
+	return nil
+}
+
+// AtBytes is At(String(b)) without allocating.
+func (self *HashMap) AtBytes(b []byte) interface{} {
+//	fmt.Printf("AtBytes %s\n", b)
+	p := self.findBytes(b)
+	if p == nil {
+		panic("HashMap.AtBytes: key not found")
+	}
+	return p.Value
+}
+
+// HasBytes is Has(String(b)) without allocating.
+func (self *HashMap) HasBytes(b []byte) bool {
+//	fmt.Printf("HasBytes %s\n", b)
+	return self.findBytes(b) != nil
+}
+
+// Upsert calls f with the current value for key, if any,
+// and stores what f returns; it looks key up only once.
+func (self *HashMap) Upsert(key Hashable, f func(old interface{}, exists bool) interface{}) {
+//	fmt.Printf("Upsert %s\n", key)
+	self.watch.start()
+	bucket, position := self.find(key)
+	switch {
+	case position == -1:
+		if value := f(nil, false); value != Delete {
+			self.insertAt(bucket, HashPair{key, value})
+		}
+	default:
+		if value := f(self.nodes.at(position).pair.Value, true); value != Delete {
+			self.update(position, value)
+		} else {
+			self.removeAt(bucket, position)
+		}
+	}
+	self.watch.end()
+}
+
+// ComputeIfAbsent returns the value for key; if there is
+// none it stores and returns what f returns instead.
+func (self *HashMap) ComputeIfAbsent(key Hashable, f func() interface{}) interface{} {
+//	fmt.Printf("ComputeIfAbsent %s\n", key)
+	bucket, position := self.find(key)
+	if position != -1 {
+		return self.nodes.at(position).pair.Value
+	}
+	value := f()
+	if value == Delete {
+		return nil
+	}
+	self.watch.start()
+	self.insertAt(bucket, HashPair{key, value})
+	self.watch.end()
+	return value
+}
+
+// ComputeIfPresent replaces the value for key with what f
+// returns, if there is a value; ok is false if there wasn't.
+func (self *HashMap) ComputeIfPresent(key Hashable, f func(old interface{}) interface{}) (value interface{}, ok bool) {
+//	fmt.Printf("ComputeIfPresent %s\n", key)
+	bucket, position := self.find(key)
+	if position == -1 {
+		return nil, false
+	}
+	value = f(self.nodes.at(position).pair.Value)
+	self.watch.start()
+	if value != Delete {
+		self.update(position, value)
+		ok = true
+	} else {
+		self.removeAt(bucket, position)
+		value, ok = nil, true
+	}
+	self.watch.end()
+	return
+}
+
+// Reserve grows the table so that n pairs fit without any
+// further rehashing, and keeps it from shrinking below that
+// until Reserve is called again. Reserve(0) lifts the floor.
+func (self *HashMap) Reserve(n int) {
+//	fmt.Printf("Reserve %d\n", n)
+	self.reserved = n
+	if self.small && n <= smallSize {
+		return
+	}
+	if s := self.tableSize(n); self.small || s > len(self.data) {
+		self.watch.start()
+		self.resize(s)
+		self.watch.end()
+	}
+}
+
+// Compact rebuilds the table at the size it would have if
+// all pairs had been inserted into a fresh map, which also
+// releases the room of pairs that have been removed.
+func (self *HashMap) Compact() {
+//	fmt.Printf("Compact\n")
+	self.watch.start()
+	switch s := self.idealSize(); {
+	case self.fitsSmall():
+		if !self.small {
+			self.toSmall()
+		}
+	default:
+		self.resizing(s)
+		self.repack(s)
+		if self.small {
+			self.leaveSmall()
+		}
+	}
+	self.watch.end()
+}
+
+// Move all pairs into a fresh table of size buckets and a
+// fresh slab just big enough for them. Unlike rehash() this
+// copies the nodes, and leaves the free ones behind.
+func (self *HashMap) repack(size int) {
+	nodes := self.nodes
+	d := self.data
+	self.nodes.initFor(self.count)
+	self.data = make([]hashVector, size)
+	for b := range d {
+		for i := d[b].head; i != 0; i = nodes.at(i).next {
+			e := nodes.at(i).pair
+			self.data[e.Key.Hash()%uint(size)].add(&self.nodes, e)
+		}
+	}
+	for b := range self.data {
+		self.data[b].owner = self.owner
+	}
+	self.tableShared = false
+}
+
+// SetAutoShrink controls whether Remove and RemoveIf shrink
+// the table, which they do by default, down to a small map
+// again once few enough pairs are left. Without it the table
+// only shrinks on Compact.
+func (self *HashMap) SetAutoShrink(on bool) {
+	self.autoShrink = on
+}
+
 func (self *HashMap) Len() int {
 //	fmt.Printf("Len %d\n", self.count)
 	return self.count
@@ -149,10 +602,20 @@ func (self *HashMap) Len() int {
 func (self *HashMap) Do(f func(key Hashable, value interface{})) {
 //	fmt.Printf("Do %s\n", f)
 	for b := range self.data {
-		if self.data[b].count > 0 {
-			for i := 0; i < self.data[b].count; i++ {
-				e := self.data[b].data[i]
-				f(e.Key, e.Value)
+		for i := self.data[b].head; i != 0; i = self.nodes.at(i).next {
+			e := self.nodes.at(i).pair
+			f(e.Key, e.Value)
+		}
+	}
+}
+
+// Range calls f for every pair until f returns false.
+func (self *HashMap) Range(f func(key Hashable, value interface{}) bool) {
+//	fmt.Printf("Range %s\n", f)
+	for b := range self.data {
+		for i := self.data[b].head; i != 0; i = self.nodes.at(i).next {
+			if e := self.nodes.at(i).pair; !f(e.Key, e.Value) {
+				return
 			}
 		}
 	}
@@ -161,11 +624,8 @@ func (self *HashMap) Do(f func(key Hashable, value interface{})) {
 func (self *HashMap) iterate(c chan<- interface{}) {
 //	fmt.Printf("Iterate %s\n", c)
 	for b := range self.data {
-		if self.data[b].count > 0 {
-			for i := 0; i < self.data[b].count; i++ {
-				e := self.data[b].data[i]
-				c <- e
-			}
+		for i := self.data[b].head; i != 0; i = self.nodes.at(i).next {
+			c <- self.nodes.at(i).pair
 		}
 	}
 	close(c)
@@ -177,3 +637,282 @@ func (self *HashMap) Iter() <-chan interface{} {
 	go self.iterate(c)
 	return c
 }
+
+// Clone returns a copy of the map. The table and the nodes
+// are copied as they are, nothing is rehashed, and Stats()
+// of the copy tell the same story.
+func (self *HashMap) Clone() *HashMap {
+//	fmt.Printf("Clone\n")
+	c := new(HashMap)
+	c.policy = self.policy
+	c.reserved = self.reserved
+	c.autoShrink = self.autoShrink
+	c.count = self.count
+	c.grows = self.grows
+	c.shrinks = self.shrinks
+	if self.small {
+		c.small = true
+		c.inline = self.inline
+		c.first = self.first
+		c.nodes = self.nodes
+		c.rebind()
+		return c
+	}
+	c.nodes = self.nodes.clone()
+	c.data = make([]hashVector, len(self.data))
+	for b := range self.data {
+		v := &c.data[b]
+		v.head = self.data[b].head
+		v.count = self.data[b].count
+		v.mixed = self.data[b].mixed
+		if self.data[b].tree != nil {
+			v.treeify(&c.nodes)
+		}
+	}
+	return c
+}
+
+// Snapshot returns a copy of the map in O(1): the two share
+// the table, the trees and the chunks of nodes, and whichever
+// writes to a bucket or a chunk first copies just that one.
+// Writes to one never show up in the other.
+func (self *HashMap) Snapshot() *HashMap {
+//	fmt.Printf("Snapshot\n")
+	if self.small {
+		return self.Clone() // just the inline pairs
+	}
+	s := new(HashMap)
+	*s = *self
+	s.watch = observers{}
+	self.owner = new(owner)
+	s.owner = new(owner)
+	self.tableShared = true
+	s.tableShared = true
+	self.nodes.share()
+	s.nodes.share()
+	return s
+}
+
+// Merge copies all pairs from other into the map. For keys
+// in both maps resolve decides the new value; a nil resolve
+// takes the value from other.
+func (self *HashMap) Merge(other *HashMap, resolve func(key Hashable, old, new interface{}) interface{}) {
+//	fmt.Printf("Merge %s\n", other)
+	self.watch.start()
+	self.presize(other.count)
+	for b := range other.data {
+		for i := other.data[b].head; i != 0; i = other.nodes.at(i).next {
+			e := other.nodes.at(i).pair
+			bucket, position := self.find(e.Key)
+			if position == -1 {
+				self.add(bucket, e)
+				continue
+			}
+			if resolve != nil {
+				old := self.nodes.at(position).pair.Value
+				e.Value = resolve(e.Key, old, e.Value)
+			}
+			self.update(position, e.Value)
+		}
+	}
+	self.watch.end()
+}
+
+// InsertAll inserts all pairs, growing the table at most
+// once up front.
+func (self *HashMap) InsertAll(pairs []HashPair) {
+//	fmt.Printf("InsertAll %d\n", len(pairs))
+	self.watch.start()
+	self.presize(len(pairs))
+	for _, e := range pairs {
+		bucket, position := self.find(e.Key)
+		if position != -1 {
+			panic("HashMap.InsertAll: duplicate key")
+		}
+		self.add(bucket, e)
+	}
+	self.watch.end()
+}
+
+// RemoveIf removes all pairs for which pred is true in one
+// pass and returns how many there were. The table shrinks
+// at most once, at the end.
+func (self *HashMap) RemoveIf(pred func(key Hashable, value interface{}) bool) int {
+//	fmt.Printf("RemoveIf %s\n", pred)
+	self.watch.start()
+	if len(self.watch.list) > 0 {
+		p := pred
+		pred = func(key Hashable, value interface{}) bool {
+			if !p(key, value) {
+				return false
+			}
+			self.watch.removed(key, value)
+			return true
+		}
+	}
+	removed := 0
+	for b := range self.data {
+		// a Snapshot's buckets are only copied if they change
+		if i := self.data[b].match(&self.nodes, pred); i != -1 {
+			self.own(b)
+			removed += self.data[b].removeFrom(&self.nodes, i, pred)
+		}
+	}
+	self.count -= removed
+
+	if self.autoShrink && !self.small && self.loadFactor() <= loadShrink {
+		if self.fitsSmall() {
+			self.toSmall()
+		} else if s := self.idealSize(); s < len(self.data) {
+			self.resize(s)
+		}
+	}
+	self.watch.end()
+	return removed
+}
+
+// RemoveAll removes all pairs and returns how many there
+// were. Unlike Init() it keeps the size policy, the reserved
+// room and the observers, and tells them.
+func (self *HashMap) RemoveAll() int {
+//	fmt.Printf("RemoveAll\n")
+	return self.RemoveIf(func(key Hashable, value interface{}) bool { return true })
+}
+
+// RetainIf removes all pairs for which pred is false and
+// returns how many there were.
+func (self *HashMap) RetainIf(pred func(key Hashable, value interface{}) bool) int {
+//	fmt.Printf("RetainIf %s\n", pred)
+	return self.RemoveIf(func(key Hashable, value interface{}) bool {
+		return !pred(key, value)
+	})
+}
+
+// Keys returns all keys in bucket order.
+func (self *HashMap) Keys() []Hashable {
+//	fmt.Printf("Keys\n")
+	keys := make([]Hashable, self.count)
+	i := 0
+	self.Do(func(key Hashable, value interface{}) {
+		keys[i] = key
+		i++
+	})
+	return keys
+}
+
+// Values returns all values in bucket order.
+func (self *HashMap) Values() []interface{} {
+//	fmt.Printf("Values\n")
+	values := make([]interface{}, self.count)
+	i := 0
+	self.Do(func(key Hashable, value interface{}) {
+		values[i] = value
+		i++
+	})
+	return values
+}
+
+// Entries returns all pairs in bucket order.
+func (self *HashMap) Entries() []HashPair {
+//	fmt.Printf("Entries\n")
+	pairs := make([]HashPair, self.count)
+	n := 0
+	for b := range self.data {
+		for i := self.data[b].head; i != 0; i = self.nodes.at(i).next {
+			pairs[n] = self.nodes.at(i).pair
+			n++
+		}
+	}
+	return pairs
+}
+
+// Filter returns a new map with the pairs for which pred
+// is true, sized for exactly those pairs.
+func (self *HashMap) Filter(pred func(key Hashable, value interface{}) bool) *HashMap {
+//	fmt.Printf("Filter %s\n", pred)
+	pairs := make([]HashPair, self.count)
+	n := 0
+	self.Do(func(key Hashable, value interface{}) {
+		if pred(key, value) {
+			pairs[n] = HashPair{key, value}
+			n++
+		}
+	})
+
+	m := new(HashMap)
+	m.policy = self.policy
+	m.autoShrink = self.autoShrink
+	m.count = n
+	if n <= smallSize {
+		m.initSmall()
+		for i := n - 1; i >= 0; i-- {
+			m.data[0].push(&m.nodes, pairs[i])
+		}
+		return m
+	}
+	m.nodes.initFor(n)
+	m.data = make([]hashVector, self.tableSize(n))
+	l := uint(len(m.data))
+	for _, e := range pairs[0:n] {
+		m.data[e.Key.Hash()%l].add(&m.nodes, e)
+	}
+	return m
+}
+
+// MapValues returns a new map with the same keys and the
+// values replaced by fn. It reuses the bucket layout so no
+// key is hashed again.
+func (self *HashMap) MapValues(fn func(key Hashable, value interface{}) interface{}) *HashMap {
+//	fmt.Printf("MapValues %s\n", fn)
+	m := self.Clone()
+	for b := range m.data {
+		for i := m.data[b].head; i != 0; i = m.nodes.at(i).next {
+			e := &m.nodes.write(i).pair
+			e.Value = fn(e.Key, e.Value)
+		}
+	}
+	return m
+}
+
+// Reduce folds fn over all pairs in bucket order, starting
+// with initial, and returns the result.
+func (self *HashMap) Reduce(initial interface{}, fn func(acc interface{}, key Hashable, value interface{}) interface{}) interface{} {
+//	fmt.Printf("Reduce %s\n", fn)
+	acc := initial
+	for b := range self.data {
+		for i := self.data[b].head; i != 0; i = self.nodes.at(i).next {
+			e := self.nodes.at(i).pair
+			acc = fn(acc, e.Key, e.Value)
+		}
+	}
+	return acc
+}
+
+// Stats describes the table, a small map as one bucket;
+// Grows and Shrinks count the rehashes since Init().
+func (self *HashMap) Stats() Stats {
+//	fmt.Printf("Stats\n")
+	var s Stats
+	s.Buckets = len(self.data)
+	s.Entries = self.count
+	s.LoadFactor = self.loadFactor()
+	s.Bytes = int(unsafe.Sizeof(*self)) + len(self.data)*int(unsafe.Sizeof(hashVector{}))
+	for b := range self.data {
+		s.ChainLengths = histogram(s.ChainLengths, self.data[b].count)
+	}
+	if !self.small {
+		s.Bytes += self.nodes.size() * int(unsafe.Sizeof(slabNode{}))
+	}
+	s.Grows = self.grows
+	s.Shrinks = self.shrinks
+	return s
+}
+
+// Dump writes the length of every chain to w, '.' for
+// empty ones and '+' for 10 or more.
+func (self *HashMap) Dump(w io.Writer) {
+//	fmt.Printf("Dump\n")
+	dump(w, self.Stats(), func(i int) byte {
+		return chainCell(self.data[i].count)
+	})
+}
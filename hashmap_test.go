@@ -4,6 +4,10 @@
 
 package hashmap
 
+import "container/hashmap/sizing"
+import "fmt"
+import "io/ioutil"
+import "strings"
 import "testing"
 
 type Integer int;
@@ -78,6 +82,649 @@ func TestIter(t *testing.T) {
 	}
 }
 
+func TestClone(t *testing.T) {
+	const Len = 1000
+	a := New()
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	c := a.Clone()
+	for i := 0; i < Len; i += 2 {
+		c.Remove(Integer(i))
+	}
+	a.Set(Integer(1), -1)
+	if a.Len() != Len || c.Len() != Len/2 {
+		t.Errorf("expected %d and %d, got %d and %d", Len, Len/2, a.Len(), c.Len())
+	}
+	for i := 0; i < Len; i++ {
+		if !a.Has(Integer(i)) {
+			t.Errorf("removing %d from clone changed original", i)
+		}
+	}
+	if c.At(Integer(1)).(int) != 1 {
+		t.Errorf("setting original changed clone")
+	}
+}
+
+// Copies keep the resize counts, also of a small map that has
+// been hashed before.
+func TestCopyStats(t *testing.T) {
+	a := New()
+	for i := 0; i < 100; i++ {
+		a.Insert(Integer(i), i) // grows
+	}
+	for i := 1; i < 100; i++ {
+		a.Remove(Integer(i)) // shrinks, down to small
+	}
+	want := a.Stats()
+	if !a.small || want.Grows == 0 || want.Shrinks == 0 {
+		t.Fatalf("expected a small map that grew and shrank, got %v", want)
+	}
+	for _, c := range []*HashMap{a.Clone(), a.Snapshot()} {
+		if s := c.Stats(); s.Buckets != want.Buckets || s.Entries != want.Entries || s.Grows != want.Grows || s.Shrinks != want.Shrinks {
+			t.Errorf("expected %v, got %v", want, s)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	const Len = 1000
+	a := New()
+	b := New()
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), 1)
+		b.Insert(Integer(i+Len/2), 2)
+	}
+	a.Merge(b, func(key Hashable, old, new interface{}) interface{} {
+		return old.(int) + new.(int)
+	})
+	if a.Len() != Len+Len/2 {
+		t.Errorf("expected %d, got %d", Len+Len/2, a.Len())
+	}
+	for i := 0; i < Len+Len/2; i++ {
+		expected := 1
+		switch {
+		case i >= Len:
+			expected = 2
+		case i >= Len/2:
+			expected = 3
+		}
+		if v := a.At(Integer(i)).(int); v != expected {
+			t.Errorf("%d: expected %d, got %d", i, expected, v)
+		}
+	}
+}
+
+func TestInsertAll(t *testing.T) {
+	const Len = 1000
+	pairs := make([]HashPair, Len)
+	for i := range pairs {
+		pairs[i] = HashPair{Integer(i), i}
+	}
+	a := New()
+	a.InsertAll(pairs)
+	if a.Len() != Len || len(a.data) != a.tableSize(Len) {
+		t.Errorf("expected %d in %d buckets, got %d in %d", Len, a.tableSize(Len), a.Len(), len(a.data))
+	}
+	for i := 0; i < Len; i++ {
+		if a.At(Integer(i)).(int) != i {
+			t.Errorf("inserted %d not found", i)
+		}
+	}
+}
+
+func TestRemoveIf(t *testing.T) {
+	const Len = 1000
+	a := New()
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	n := a.RemoveIf(func(key Hashable, value interface{}) bool {
+		return value.(int)%10 != 0
+	})
+	if n != Len-Len/10 || a.Len() != Len/10 {
+		t.Errorf("expected %d removed and %d left, got %d and %d", Len-Len/10, Len/10, n, a.Len())
+	}
+	if len(a.data) != a.tableSize(2*Len/10) {
+		t.Errorf("expected %d buckets, got %d", a.tableSize(2*Len/10), len(a.data))
+	}
+	for i := 0; i < Len; i++ {
+		if a.Has(Integer(i)) != (i%10 == 0) {
+			t.Errorf("RemoveIf got %d wrong", i)
+		}
+	}
+	a.RetainIf(func(key Hashable, value interface{}) bool {
+		return key.(Integer) < 500
+	})
+	if a.Len() != Len/20 {
+		t.Errorf("expected %d, got %d", Len/20, a.Len())
+	}
+}
+
+func TestRemoveAll(t *testing.T) {
+	const Len = 1000
+	a := New()
+	a.Reserve(Len)
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	if n := a.RemoveAll(); n != Len || a.Len() != 0 {
+		t.Errorf("expected %d removed and none left, got %d and %d", Len, n, a.Len())
+	}
+	if len(a.data) != a.tableSize(Len) {
+		t.Errorf("expected the %d reserved buckets to stay, got %d", a.tableSize(Len), len(a.data))
+	}
+	a.Insert(Integer(1), 1)
+	if a.Len() != 1 || a.At(Integer(1)).(int) != 1 {
+		t.Errorf("map broken after RemoveAll")
+	}
+}
+
+// How many chunks of nodes a has copied since a Snapshot s.
+func copiedChunks(a, s *HashMap) int {
+	n := 0
+	for c := range a.nodes.chunks {
+		if c < len(s.nodes.chunks) && &a.nodes.chunks[c][0] != &s.nodes.chunks[c][0] {
+			n++
+		}
+	}
+	return n
+}
+
+// RemoveIf takes over a Snapshot's table and nodes only
+// where it removes something.
+func TestRemoveIfSnapshot(t *testing.T) {
+	const Len = 4 * slabChunk
+	a := New()
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	s := a.Snapshot()
+	if a.RemoveIf(func(key Hashable, value interface{}) bool { return false }) != 0 || !a.tableShared || copiedChunks(a, s) != 0 {
+		t.Errorf("RemoveIf that removed nothing copied the table")
+	}
+	a.RemoveIf(func(key Hashable, value interface{}) bool { return key.(Integer) == 1 })
+	// the node's chunk, and maybe its predecessor's
+	if c := copiedChunks(a, s); c < 1 || c > 2 || s.Len() != Len || !s.Has(Integer(1)) {
+		t.Errorf("expected RemoveIf to copy 1 or 2 chunks, copied %d", c)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	const Len = 100
+	a := New()
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	keys, values, pairs := a.Keys(), a.Values(), a.Entries()
+	if len(keys) != Len || len(values) != Len || len(pairs) != Len {
+		t.Fatalf("expected %d, got %d keys, %d values, %d pairs", Len, len(keys), len(values), len(pairs))
+	}
+	for i := range pairs {
+		if pairs[i].Key != keys[i] || pairs[i].Value != values[i] {
+			t.Errorf("Keys, Values and Entries disagree at %d", i)
+		}
+	}
+	sum := a.Reduce(0, func(acc interface{}, key Hashable, value interface{}) interface{} {
+		return acc.(int) + value.(int)
+	})
+	if sum.(int) != Len*(Len-1)/2 {
+		t.Errorf("expected %d, got %d", Len*(Len-1)/2, sum)
+	}
+	even := a.Filter(func(key Hashable, value interface{}) bool {
+		return value.(int)%2 == 0
+	})
+	if even.Len() != Len/2 || len(even.data) != a.tableSize(Len/2) {
+		t.Errorf("expected %d in %d buckets, got %d in %d", Len/2, a.tableSize(Len/2), even.Len(), len(even.data))
+	}
+	squares := a.MapValues(func(key Hashable, value interface{}) interface{} {
+		return value.(int) * value.(int)
+	})
+	for i := 0; i < Len; i++ {
+		if even.Has(Integer(i)) != (i%2 == 0) {
+			t.Errorf("Filter got %d wrong", i)
+		}
+		if squares.At(Integer(i)).(int) != i*i || a.At(Integer(i)).(int) != i {
+			t.Errorf("MapValues got %d wrong", i)
+		}
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	const Len = 1000
+	a := New()
+	for i := 0; i < 3*Len; i++ {
+		a.Upsert(Integer(i%Len), func(old interface{}, exists bool) interface{} {
+			if !exists {
+				return 1
+			}
+			return old.(int) + 1
+		})
+	}
+	for i := 0; i < Len; i++ {
+		if v := a.At(Integer(i)).(int); v != 3 {
+			t.Errorf("expected 3 for %d, got %d", i, v)
+		}
+	}
+	for i := 0; i < Len; i += 2 {
+		a.Upsert(Integer(i), func(old interface{}, exists bool) interface{} { return Delete })
+	}
+	a.Upsert(Integer(-1), func(old interface{}, exists bool) interface{} { return Delete })
+	if a.Len() != Len/2 || a.Has(Integer(-1)) {
+		t.Errorf("expected %d, got %d", Len/2, a.Len())
+	}
+}
+
+func TestCompute(t *testing.T) {
+	a := New()
+	calls := 0
+	f := func() interface{} { calls++; return calls }
+	if a.ComputeIfAbsent(Integer(1), f).(int) != 1 || a.ComputeIfAbsent(Integer(1), f).(int) != 1 {
+		t.Errorf("ComputeIfAbsent recomputed present key")
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+	if _, ok := a.ComputeIfPresent(Integer(2), func(old interface{}) interface{} { return 2 }); ok || a.Has(Integer(2)) {
+		t.Errorf("ComputeIfPresent inserted missing key")
+	}
+	if v, ok := a.ComputeIfPresent(Integer(1), func(old interface{}) interface{} { return old.(int) * 10 }); !ok || v.(int) != 10 {
+		t.Errorf("expected 10, got %v", v)
+	}
+	a.ComputeIfPresent(Integer(1), func(old interface{}) interface{} { return Delete })
+	if a.Len() != 0 {
+		t.Errorf("expected 0, got %d", a.Len())
+	}
+}
+
+func TestResizeStats(t *testing.T) {
+	const Len = 1000
+	a := New()
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	s := a.Stats()
+	if s.Buckets != a.tableSize(Len-1) || s.Grows != 7 || s.Shrinks != 0 {
+		t.Errorf("expected %d buckets after 7 grows, got %d after %d and %d shrinks", a.tableSize(Len-1), s.Buckets, s.Grows, s.Shrinks)
+	}
+	for i := 0; i < Len; i++ {
+		a.Remove(Integer(i))
+	}
+	if s = a.Stats(); s.Shrinks == 0 || s.ChainLengths[0] != s.Buckets {
+		t.Errorf("expected empty chains after shrinking, got %v after %d shrinks", s.ChainLengths, s.Shrinks)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	const Len = 1000
+	a := NewWithPolicy(sizing.PrimesBetweenPowers)
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	if n := uint64(len(a.data)); !sizing.IsPrime(n) {
+		t.Errorf("%d buckets is not a prime", n)
+	}
+	for i := 0; i < Len; i++ {
+		if a.At(Integer(i)).(int) != i {
+			t.Errorf("inserted %d not found", i)
+		}
+		a.Remove(Integer(i))
+	}
+	if !a.small {
+		t.Errorf("expected to shrink to a small map, got %d buckets", len(a.data))
+	}
+}
+
+// Grows eight times over at once, so that without
+// hysteresis the first Remove after a grow shrinks back.
+type octuple struct{}
+
+func (octuple) Initial() uint64 { return 8 }
+func (octuple) Grow(n uint64) uint64 {
+	if n >= 1<<60 {
+		return 0
+	}
+	return n * 8
+}
+func (octuple) Shrink(n uint64) uint64 {
+	if n <= 8 {
+		return n
+	}
+	return n / 8
+}
+
+func TestNoThrash(t *testing.T) {
+	const Rounds = 1000
+	for _, p := range []sizing.SizePolicy{sizing.PowerOfTwo, octuple{}} {
+		a := NewWithPolicy(p)
+		i := 0
+		for ; a.Stats().Grows == 0; i++ {
+			a.Insert(Integer(i), i)
+		}
+		before := a.Stats()
+		for r := 0; r < Rounds; r++ {
+			a.Remove(Integer(i - 1))
+			a.Insert(Integer(i-1), i-1)
+		}
+		after := a.Stats()
+		if n := after.Grows + after.Shrinks - before.Grows - before.Shrinks; n != 0 {
+			t.Errorf("%T: expected no rehash at %d pairs, got %d", p, i, n)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	const Len = 1000
+	a := New()
+	a.Reserve(Len)
+	s := a.Stats()
+	if s.Buckets != a.tableSize(Len) || s.Grows != 1 {
+		t.Errorf("expected %d buckets after 1 grow, got %d after %d", a.tableSize(Len), s.Buckets, s.Grows)
+	}
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	for i := 0; i < Len; i++ {
+		a.Remove(Integer(i))
+	}
+	if s = a.Stats(); s.Buckets != a.tableSize(Len) || s.Grows != 1 || s.Shrinks != 0 {
+		t.Errorf("expected %d buckets without rehash, got %d after %d grows and %d shrinks", a.tableSize(Len), s.Buckets, s.Grows, s.Shrinks)
+	}
+	a.Compact()
+	if len(a.data) != a.tableSize(Len) {
+		t.Errorf("expected Compact to keep %d buckets, got %d", a.tableSize(Len), len(a.data))
+	}
+	a.Reserve(0)
+	a.Compact()
+	if !a.small {
+		t.Errorf("expected Compact to make a small map, got %d buckets", len(a.data))
+	}
+}
+
+func TestAutoShrink(t *testing.T) {
+	const Len = 1000
+	a := New()
+	a.SetAutoShrink(false)
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	size := len(a.data)
+	for i := 0; i < Len; i++ {
+		if i%10 != 0 {
+			a.Remove(Integer(i))
+		}
+	}
+	a.RemoveIf(func(key Hashable, value interface{}) bool {
+		return value.(int) >= Len/2
+	})
+	if s := a.Stats(); s.Buckets != size || s.Shrinks != 0 {
+		t.Errorf("expected %d buckets without shrinking, got %d after %d shrinks", size, s.Buckets, s.Shrinks)
+	}
+	a.Compact()
+	if len(a.data) != a.tableSize(2*Len/20) {
+		t.Errorf("expected Compact to shrink to %d buckets, got %d", a.tableSize(2*Len/20), len(a.data))
+	}
+	for i := 0; i < Len/2; i += 10 {
+		if a.At(Integer(i)).(int) != i {
+			t.Errorf("%d lost in Compact", i)
+		}
+	}
+}
+
+// Counts calls to Hash(), so tests can tell whether a map
+// hashes at all.
+var hashes int
+
+type counted int
+
+func (self counted) Hash() uint {
+	hashes++
+	return uint(self)
+}
+func (self counted) Equal(other Hashable) bool { return self == other.(counted) }
+
+func TestSmall(t *testing.T) {
+	a := New()
+	hashes = 0
+	for i := 0; i < smallSize; i++ {
+		a.Insert(counted(i), i)
+	}
+	for i := 0; i < 2*smallSize; i++ {
+		if a.Has(counted(i)) != (i < smallSize) {
+			t.Errorf("Has(%d) is wrong", i)
+		}
+	}
+	if !a.small || hashes != 0 {
+		t.Errorf("expected a small map and no hashing, got %d buckets and %d hashes", len(a.data), hashes)
+	}
+
+	c := a.Clone()
+	c.Set(counted(0), -1)
+	c.Remove(counted(1))
+	if a.At(counted(0)).(int) != 0 || !a.Has(counted(1)) || c.Len() != smallSize-1 {
+		t.Errorf("Clone of a small map shares its pairs")
+	}
+
+	a.Insert(counted(smallSize), smallSize)
+	if a.small || hashes == 0 {
+		t.Errorf("expected a hashed map after %d pairs", a.Len())
+	}
+	for i := 0; i <= smallSize; i++ {
+		if a.At(counted(i)).(int) != i {
+			t.Errorf("%d lost growing out of small", i)
+		}
+	}
+	for i := smallSize; i > 1; i-- {
+		a.Remove(counted(i))
+	}
+	if !a.small || a.At(counted(0)).(int) != 0 || a.At(counted(1)).(int) != 1 {
+		t.Errorf("expected a small map again, got %d buckets", len(a.data))
+	}
+
+	a.SetAutoShrink(false)
+	for i := 2; i < 2*smallSize; i++ {
+		a.Insert(counted(i), i)
+	}
+	for i := 2; i < 2*smallSize; i++ {
+		a.Remove(counted(i))
+	}
+	if a.small {
+		t.Errorf("expected no switch back without auto shrinking")
+	}
+	a.Compact()
+	if !a.small || a.Len() != 2 {
+		t.Errorf("expected Compact to make a small map of 2, got %d buckets and %d pairs", len(a.data), a.Len())
+	}
+	f := New()
+	f.InsertAll([]HashPair{HashPair{counted(1), 1}})
+	if !f.small {
+		t.Errorf("expected InsertAll of one pair to stay small")
+	}
+}
+
+// Compact hashes every pair once, whether it resizes the
+// table or not, and whether the map was small or not.
+func TestCompactHashesOnce(t *testing.T) {
+	for _, n := range []int{smallSize, 1000} {
+		for _, keep := range []bool{true, false} {
+			a := New()
+			a.SetAutoShrink(false)
+			for i := 0; i < n; i++ {
+				a.Insert(counted(i), i)
+			}
+			if !keep {
+				for i := n / 2; i < n; i++ {
+					a.Remove(counted(i))
+				}
+			}
+			hashes = 0
+			a.Compact()
+			if hashes != a.Len() {
+				t.Errorf("%d, %v: Compact hashed %d times for %d pairs", n, keep, hashes, a.Len())
+			}
+			for i := 0; i < n; i++ {
+				if a.Has(counted(i)) != (keep || i < n/2) {
+					t.Errorf("%d, %v: Has(%d) is wrong after Compact", n, keep, i)
+				}
+			}
+		}
+	}
+}
+
+// Whether m has exactly the pairs i -> value(i) for i < n
+// that keep says it should.
+func holds(m *HashMap, n int, keep func(i int) bool, value func(i int) int) bool {
+	count := 0
+	for i := 0; i < n; i++ {
+		if m.Has(Integer(i)) != keep(i) {
+			return false
+		}
+		if keep(i) {
+			if m.At(Integer(i)).(int) != value(i) {
+				return false
+			}
+			count++
+		}
+	}
+	return m.Len() == count
+}
+
+func TestSnapshot(t *testing.T) {
+	const Len = 4 * slabChunk
+	all := func(i int) bool { return true }
+	same := func(i int) int { return i }
+	a := New()
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	s := a.Snapshot()
+	if &s.data[0] != &a.data[0] || copiedChunks(a, s) != 0 {
+		t.Errorf("Snapshot copied the table")
+	}
+
+	a.Set(Integer(1), -1)
+	if c := copiedChunks(a, s); c != 1 || !a.tableShared {
+		t.Errorf("expected Set to copy 1 chunk and no table, copied %d", c)
+	}
+
+	a.Remove(Integer(2))
+	a.Upsert(Integer(3), func(old interface{}, exists bool) interface{} { return -3 })
+	a.ComputeIfPresent(Integer(4), func(old interface{}) interface{} { return Delete })
+	a.RemoveIf(func(key Hashable, value interface{}) bool { return key.(Integer) >= Len/2 })
+	if !holds(s, Len, all, same) {
+		t.Errorf("writes to the map leaked into the snapshot")
+	}
+	for i := Len; i < 4*Len; i++ {
+		a.Insert(Integer(i), i) // grows
+	}
+	if !holds(s, 4*Len, func(i int) bool { return i < Len }, same) {
+		t.Errorf("growing the map changed the snapshot")
+	}
+
+	s.Set(Integer(10), -10)
+	s.Remove(Integer(11))
+	if a.At(Integer(10)).(int) != 10 || !a.Has(Integer(11)) {
+		t.Errorf("writes to the snapshot leaked into the map")
+	}
+	if a.At(Integer(1)).(int) != -1 || a.Has(Integer(2)) || a.At(Integer(3)).(int) != -3 || a.Has(Integer(4)) {
+		t.Errorf("map lost its own writes")
+	}
+
+	// snapshots of snapshots, and small maps
+	s2 := s.Snapshot()
+	s.Set(Integer(12), -12)
+	if s2.At(Integer(12)).(int) != 12 {
+		t.Errorf("second snapshot changed")
+	}
+	c := New()
+	c.Insert(Integer(1), 1)
+	cs := c.Snapshot()
+	c.Set(Integer(1), -1)
+	if cs.At(Integer(1)).(int) != 1 {
+		t.Errorf("snapshot of a small map changed")
+	}
+}
+
+// Trees are changed in place too, so they must be copied
+// along with their bucket.
+func TestSnapshotTrees(t *testing.T) {
+	const Len = 1000
+	a := New()
+	for i := 0; i < Len; i++ {
+		a.Insert(orderedCollider(i), i)
+	}
+	s := a.Snapshot()
+	for i := 0; i < Len; i += 2 {
+		a.Remove(orderedCollider(i))
+	}
+	for i := 0; i < Len; i++ {
+		if !s.Has(orderedCollider(i)) || s.At(orderedCollider(i)).(int) != i {
+			t.Errorf("%d lost from the snapshot", i)
+		}
+		if a.Has(orderedCollider(i)) != (i%2 == 1) {
+			t.Errorf("Has(%d) is wrong", i)
+		}
+	}
+}
+
+func benchmarkSmallAt(b *testing.B, n int) {
+	b.StopTimer()
+	m := New()
+	for i := 0; i < n; i++ {
+		m.Insert(Integer(i), i)
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		m.At(Integer(i % n))
+	}
+}
+
+func benchmarkSmallAtBuiltin(b *testing.B, n int) {
+	b.StopTimer()
+	m := make(map[int]int)
+	for i := 0; i < n; i++ {
+		m[i] = i
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		_ = m[i%n]
+	}
+}
+
+func benchmarkSmallBuild(b *testing.B, n int) {
+	for i := 0; i < b.N; i++ {
+		m := New()
+		for j := 0; j < n; j++ {
+			m.Insert(Integer(j), j)
+		}
+	}
+}
+
+func benchmarkSmallBuildBuiltin(b *testing.B, n int) {
+	for i := 0; i < b.N; i++ {
+		m := make(map[int]int)
+		for j := 0; j < n; j++ {
+			m[j] = j
+		}
+	}
+}
+
+func BenchmarkSmallAt1(b *testing.B)  { benchmarkSmallAt(b, 1) }
+func BenchmarkSmallAt4(b *testing.B)  { benchmarkSmallAt(b, 4) }
+func BenchmarkSmallAt16(b *testing.B) { benchmarkSmallAt(b, 16) }
+
+func BenchmarkSmallAtBuiltin1(b *testing.B)  { benchmarkSmallAtBuiltin(b, 1) }
+func BenchmarkSmallAtBuiltin4(b *testing.B)  { benchmarkSmallAtBuiltin(b, 4) }
+func BenchmarkSmallAtBuiltin16(b *testing.B) { benchmarkSmallAtBuiltin(b, 16) }
+
+func BenchmarkSmallBuild1(b *testing.B)  { benchmarkSmallBuild(b, 1) }
+func BenchmarkSmallBuild4(b *testing.B)  { benchmarkSmallBuild(b, 4) }
+func BenchmarkSmallBuild16(b *testing.B) { benchmarkSmallBuild(b, 16) }
+
+func BenchmarkSmallBuildBuiltin1(b *testing.B)  { benchmarkSmallBuildBuiltin(b, 1) }
+func BenchmarkSmallBuildBuiltin4(b *testing.B)  { benchmarkSmallBuildBuiltin(b, 4) }
+func BenchmarkSmallBuildBuiltin16(b *testing.B) { benchmarkSmallBuildBuiltin(b, 16) }
+
 func BenchmarkLen(b *testing.B) {
 	b.StopTimer()
 	m := New()
@@ -96,6 +743,46 @@ func BenchmarkInsert(b *testing.B) {
 	}
 }
 
+// The keys are boxed up front, so only the map's own
+// allocations count: the tables and the chunks of nodes.
+func boxedKeys(n int) []Hashable {
+	keys := make([]Hashable, n)
+	for i := range keys {
+		keys[i] = Integer(i)
+	}
+	return keys
+}
+
+// Inserting allocates once per grow and once per chunk of
+// nodes, not once per pair.
+func TestInsertAllocs(t *testing.T) {
+	const Len = 100000
+	keys := boxedKeys(Len)
+	m := New()
+	before := mallocs()
+	for i := 0; i < Len; i++ {
+		m.Insert(keys[i], nil)
+	}
+	n := mallocs() - before
+	s := m.Stats()
+	if max := uint64(Len/slabChunk + 4*s.Grows + 8); n > max {
+		t.Errorf("%d inserts allocated %d times, expected at most %d", Len, n, max)
+	}
+}
+
+func BenchmarkInsertAllocs(b *testing.B) {
+	b.StopTimer()
+	keys := boxedKeys(b.N)
+	m := New()
+	before := mallocs()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		m.Insert(keys[i], nil)
+	}
+	b.StopTimer()
+	fmt.Printf("%d inserts, %d allocations\n", b.N, mallocs()-before)
+}
+
 func BenchmarkRemove(b *testing.B) {
 	b.StopTimer()
 	m := New()
@@ -155,3 +842,100 @@ func BenchmarkFailedLookup(b *testing.B) {
 		m.Has(Integer(-i));
 	}
 }
+
+// Word counts over example_hashmap.go's dictionary.
+
+type word string
+
+func (self word) Hash() uint {
+	var h uint = 5381
+	for _, r := range self {
+		h = (h << 5) + h + uint(r)
+	}
+	return h
+}
+
+func (self word) Equal(other Hashable) bool { return self == other.(word) }
+
+func dictionary() []string {
+	raw, error := ioutil.ReadFile("/usr/share/dict/cracklib-words")
+	if error != nil {
+		return nil
+	}
+	return strings.Split(string(raw), "\n", 0)
+}
+
+func BenchmarkWordCountUpsert(b *testing.B) {
+	b.StopTimer()
+	words := dictionary()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		m := New()
+		for _, w := range words {
+			m.Upsert(word(w), func(old interface{}, exists bool) interface{} {
+				if !exists {
+					return 1
+				}
+				return old.(int) + 1
+			})
+		}
+	}
+}
+
+func BenchmarkWordCountHasAtSet(b *testing.B) {
+	b.StopTimer()
+	words := dictionary()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		m := New()
+		for _, w := range words {
+			if m.Has(word(w)) {
+				m.Set(word(w), m.At(word(w)).(int)+1)
+			} else {
+				m.Insert(word(w), 1)
+			}
+		}
+	}
+}
+
+func TestObserveBulk(t *testing.T) {
+	const Len = 1000
+	a := New()
+	m := newMirror(t, a)
+	a.Observe(m.observer())
+	b := New()
+	for i := 0; i < Len; i++ {
+		b.Insert(Int(i), i)
+	}
+	a.Merge(b, nil)
+	m.check("after Merge", a)
+	a.Merge(b, func(key Hashable, old, new interface{}) interface{} { return old.(int) + new.(int) })
+	m.check("after resolved Merge", a)
+	for i := 0; i < Len; i++ {
+		a.Upsert(Int(i+Len/2), func(old interface{}, exists bool) interface{} {
+			if exists && i%3 == 0 {
+				return Delete
+			}
+			return i
+		})
+	}
+	m.check("after Upsert", a)
+	for i := 0; i < Len; i++ {
+		a.ComputeIfAbsent(Int(i), func() interface{} { return -i })
+		a.ComputeIfPresent(Int(i+Len), func(old interface{}) interface{} { return old.(int) + 1 })
+	}
+	m.check("after Compute", a)
+	a.RemoveIf(func(key Hashable, value interface{}) bool { return key.(Int)%5 != 0 })
+	m.check("after RemoveIf", a)
+	a.Reserve(4 * Len)
+	m.check("after Reserve", a)
+	a.Reserve(0)
+	a.Compact()
+	m.check("after Compact", a)
+	pairs := make([]HashPair, Len)
+	for i := range pairs {
+		pairs[i] = HashPair{Int(2*Len + i), i}
+	}
+	a.InsertAll(pairs)
+	m.check("after InsertAll", a)
+}
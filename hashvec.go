@@ -2,60 +2,193 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// A specialized container/vector clone for hash buckets.
-//
-// These never shrink: If they empty out, the hash table
-// will hopefully shrink/rehash soon anyway.
+// The chain of one hash bucket. It started out as a
+// specialized container/vector clone, hence the name; now
+// the pairs live in the map's slab, linked by index, so a
+// chain never allocates by itself and rehashing only
+// relinks its nodes. Every method gets the slab.
 
 package hashmap
 
-const initialLength = 2
-
 type hashVector struct {
-	data []HashPair
-	count int
+	head	int // first node, 0 if empty
+	count	int
+	tree	*treeNode // indexes the nodes once it gets long
+	mixed	bool // keys can't make a tree, see link()
+	owner	*owner // the map that may change tree in place
 }
 
-func (self *hashVector) find(key Hashable) int {
-	d := self.data
-	if d != nil {
-		l := self.count
-		for i := 0; i < l; i++ {
-			if key.Equal(d[i].Key) {
-				return i
-			}
+// Returns the node for key, or -1.
+func (self *hashVector) find(s *slab, key Hashable) int {
+	if self.tree != nil {
+		// all keys in a tree have the same type
+		k, ok := key.(Ordered)
+		if !ok || !sameType(key, self.tree.key) {
+			return -1
+		}
+		if t := self.tree.get(k); t != nil {
+			return t.pos
+		}
+		return -1
+	}
+	for i := self.head; i != 0; i = s.at(i).next {
+		if keysEqual(key, s.at(i).pair.Key) {
+			return i
 		}
 	}
 	return -1
 }
 
-func (self *hashVector) grow() {
-	d := make([]HashPair, len(self.data)*2)
-	copy(d, self.data)
-	self.data = d
+// Link a new node for pair in front of the chain, leaving
+// the tree alone; returns the node.
+func (self *hashVector) push(s *slab, pair HashPair) int {
+	self.head = s.alloc(pair, self.head)
+	self.count++
+	return self.head
 }
 
-func (self *hashVector) push(pair HashPair) {
-	d := self.data
-	if d == nil {
-		// lazy: avoid allocation for empty buckets
-		// small: assuming good hash function
-		self.data = make([]HashPair, initialLength)
-		d = self.data
+// Push a pair whose key isn't in the chain yet, and turn
+// it into a tree once it gets long. MultiMap can't use it,
+// its keys repeat.
+func (self *hashVector) add(s *slab, pair HashPair) {
+	self.link(s, s.alloc(pair, 0))
+}
+
+// Put node i, whose key isn't in the chain yet, in front of
+// it; add() for a node that already exists. Once the keys
+// turn out to be mixed, a long chain stays a chain until it
+// gets shorter than untreeifyLength, instead of trying to
+// treeify it again on every push.
+func (self *hashVector) link(s *slab, i int) {
+	s.write(i).next = self.head
+	self.head = i
+	self.count++
+	key := s.at(i).pair.Key
+	switch {
+	case self.tree != nil:
+		if k, ok := key.(Ordered); ok && sameType(key, self.tree.key) {
+			self.tree = treeInsert(self.tree, k, i)
+		} else {
+			self.tree = nil
+			self.mixed = true
+		}
+	case self.count >= treeifyLength && !self.mixed:
+		self.treeify(s)
+		self.mixed = self.tree == nil
 	}
+}
 
-	c := self.count
-	if c == len(d) {
-		self.grow();
-		d = self.data
+// Index all nodes in a tree, unless some key isn't Ordered
+// or they aren't all of one type.
+func (self *hashVector) treeify(s *slab) {
+	var t *treeNode
+	first := s.at(self.head).pair.Key
+	for i := self.head; i != 0; i = s.at(i).next {
+		key := s.at(i).pair.Key
+		k, ok := key.(Ordered)
+		if !ok || !sameType(key, first) {
+			self.tree = nil
+			return
+		}
+		t = treeInsert(t, k, i)
 	}
+	self.tree = t
+}
 
-	d[c] = pair
+// Link a new node for pair right after node prev, which is
+// in the chain. Only MultiMap uses it, its chains are never
+// trees.
+func (self *hashVector) insertAfter(s *slab, prev int, pair HashPair) {
+	n := s.write(prev)
+	n.next = s.alloc(pair, n.next)
 	self.count++
 }
 
-func (self *hashVector) pop(i int) {
-	d := self.data
-	copy(d[i:], d[i+1:]) // explicit loop does worth despite slice allocation
+// Unlink node i, which follows prev (0 if i is the head),
+// and free it. Only for chains that aren't trees.
+func (self *hashVector) unlink(s *slab, prev int, i int) {
+	next := s.at(i).next
+	if prev == 0 {
+		self.head = next
+	} else {
+		s.write(prev).next = next
+	}
+	s.release(i)
 	self.count--
+	if self.count < untreeifyLength {
+		self.mixed = false
+	}
+}
+
+func (self *hashVector) pop(s *slab, i int) {
+	if self.tree != nil {
+		self.popTree(s, i)
+		return
+	}
+	prev := 0
+	for j := self.head; j != i; j = s.at(j).next {
+		prev = j
+	}
+	self.unlink(s, prev, i)
+}
+
+// Trees don't keep the chain order, the head moves into the
+// hole instead so no predecessor is needed.
+func (self *hashVector) popTree(s *slab, i int) {
+	self.tree = treeRemove(self.tree, s.at(i).pair.Key.(Ordered))
+	head := self.head
+	if i != head {
+		n := s.write(i)
+		n.pair = s.at(head).pair
+		self.tree.get(n.pair.Key.(Ordered)).pos = i
+	}
+	self.unlink(s, 0, head)
+	if self.count < untreeifyLength {
+		self.tree = nil
+	}
+}
+
+// Drop all pairs for which pred is true, keeping the order
+// of the others; returns how many were dropped.
+func (self *hashVector) removeIf(s *slab, pred func(key Hashable, value interface{}) bool) int {
+	first := self.match(s, pred)
+	if first == -1 {
+		return 0
+	}
+	return self.removeFrom(s, first, pred)
+}
+
+// The first node for which pred is true, or -1.
+func (self *hashVector) match(s *slab, pred func(key Hashable, value interface{}) bool) int {
+	for i := self.head; i != 0; i = s.at(i).next {
+		if e := s.at(i).pair; pred(e.Key, e.Value) {
+			return i
+		}
+	}
+	return -1
+}
+
+// removeIf for a chain whose first match is known to be
+// node first; pred isn't asked about it again.
+func (self *hashVector) removeFrom(s *slab, first int, pred func(key Hashable, value interface{}) bool) int {
+	n := 0
+	prev := 0
+	for i := self.head; i != 0; {
+		next := s.at(i).next
+		if e := s.at(i).pair; i == first || (n > 0 && pred(e.Key, e.Value)) {
+			self.unlink(s, prev, i)
+			n++
+		} else {
+			prev = i
+		}
+		i = next
+	}
+	if self.tree != nil {
+		if self.count < untreeifyLength {
+			self.tree = nil
+		} else {
+			self.treeify(s) // the others kept their nodes
+		}
+	}
+	return n
 }
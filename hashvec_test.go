@@ -6,29 +6,92 @@ package hashmap
 
 import "testing"
 
+func TestTreeify(t *testing.T) {
+	const Len = 100
+	var v hashVector
+	var nodes slab
+	for i := 0; i < Len; i++ {
+		v.add(&nodes, HashPair{orderedCollider(i), i})
+		if (v.tree != nil) != (i+1 >= treeifyLength) {
+			t.Fatalf("tree is %v with %d pairs", v.tree, v.count)
+		}
+	}
+	for i := 0; i < Len; i++ {
+		if p := v.find(&nodes, orderedCollider(i)); p == -1 || nodes.at(p).pair.Value.(int) != i {
+			t.Errorf("%d not found in tree", i)
+		}
+	}
+	v.removeIf(&nodes, func(key Hashable, value interface{}) bool { return value.(int)%2 == 0 })
+	for i := 0; i < Len; i++ {
+		if (v.find(&nodes, orderedCollider(i)) == -1) != (i%2 == 0) {
+			t.Errorf("removeIf got %d wrong", i)
+		}
+	}
+	for i := 1; v.count > 0; i += 2 {
+		v.pop(&nodes, v.find(&nodes, orderedCollider(i)))
+		if (v.tree != nil) != (v.count >= untreeifyLength) {
+			t.Fatalf("tree is %v with %d pairs", v.tree, v.count)
+		}
+		for j := i + 2; j < Len; j += 2 {
+			if v.find(&nodes, orderedCollider(j)) == -1 {
+				t.Fatalf("%d lost after popping %d", j, i)
+			}
+		}
+	}
+	if v.head != 0 {
+		t.Errorf("empty chain starts at node %d", v.head)
+	}
+
+	// a single key that isn't Ordered keeps it a chain
+	var w hashVector
+	w.add(&nodes, HashPair{Integer(-1), nil})
+	for i := 0; i < Len; i++ {
+		w.add(&nodes, HashPair{orderedCollider(i), i})
+	}
+	if w.tree != nil || !w.mixed {
+		t.Errorf("treeified %d pairs with an Integer key", w.count)
+	}
+	// it stays a chain until it gets short, then may be a
+	// tree again
+	for i := 0; w.count >= untreeifyLength; i++ {
+		w.pop(&nodes, w.find(&nodes, orderedCollider(i)))
+		if !w.mixed && w.count >= untreeifyLength {
+			t.Fatalf("forgot the keys are mixed at %d pairs", w.count)
+		}
+	}
+	w.pop(&nodes, w.find(&nodes, Integer(-1)))
+	for i := 0; w.tree == nil; i++ {
+		w.add(&nodes, HashPair{orderedCollider(-1 - i), i})
+		if w.count > treeifyLength {
+			t.Fatalf("no tree at %d pairs of one type", w.count)
+		}
+	}
+}
+
 func BenchmarkHashVectorPush(b *testing.B) {
 	b.StopTimer()
 	var m hashVector
+	var nodes slab
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
-		m.push(HashPair{Integer(i), true})
+		m.push(&nodes, HashPair{Integer(i), true})
 	}
 }
 
 func BenchmarkHashVectorPop(b *testing.B) {
-	// TODO: tried to focus on short vectors here, correct?
+	// TODO: tried to focus on short chains here, correct?
 	b.StopTimer()
-	var d hashVector
-	for i := 0; i < 8; i++ {
-		d.push(HashPair{Integer(i), true})
-	}
+	var m hashVector
+	var nodes slab
 	b.StartTimer()
 	for i := 0; i < b.N; i++ {
 		b.StopTimer()
-		m := d
+		for j := 0; j < 8; j++ {
+			m.push(&nodes, HashPair{Integer(j), true})
+		}
 		b.StartTimer()
 		for m.count > 0 {
-			m.pop(0)
+			m.pop(&nodes, m.head)
 		}
 	}
 }
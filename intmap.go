@@ -0,0 +1,226 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+//import "fmt"
+import "io"
+import "unsafe"
+
+// IntMap doesn't use as much load as HashMap, it probes
+// linearly in one flat array instead of chaining.
+const intLoadGrow = 0.5
+const intLoadShrink = 0.125
+const intMinimumSize = 8
+
+// Fibonacci hashing: multiply by 2**64 / golden ratio and
+// take the top bits, which mixes low and high key bits.
+const intMultiplier = 0x9E3779B97F4A7C15
+
+// IntMap maps uint64 keys to uint64 values. Everything lives
+// in flat arrays without a single pointer, so the garbage
+// collector doesn't have to scan them, and there are no
+// per-pair allocations or interface boxes. Other fixed-size
+// keys and values (small byte arrays, pairs of int32s) can
+// be packed into a uint64.
+// You must call Init() before using it.
+type IntMap struct {
+	keys	[]uint64
+	values	[]uint64
+	used	[]bool
+	count	int
+	shift	uint // 64 - log2(len(keys))
+	grows	int // for Stats()
+	shrinks	int
+}
+
+func (self *IntMap) home(key uint64) int {
+	return int((key * intMultiplier) >> self.shift)
+}
+
+func (self *IntMap) loadFactor() float {
+//	fmt.Printf("loadFactor %d/%d\n", self.count, len(self.keys))
+	return float(self.count) / float(len(self.keys))
+}
+
+func (self *IntMap) alloc(size int) {
+	self.keys = make([]uint64, size)
+	self.values = make([]uint64, size)
+	self.used = make([]bool, size)
+	self.shift = 64
+	for s := size; s > 1; s >>= 1 {
+		self.shift--
+	}
+}
+
+func (self *IntMap) resize(size int) {
+//	fmt.Printf("resize %d\n", size)
+	if size > len(self.keys) {
+		self.grows++
+	} else {
+		self.shrinks++
+	}
+	keys, values, used := self.keys, self.values, self.used
+	self.alloc(size)
+	for i := range keys {
+		if used[i] {
+			j := self.find(keys[i])
+			self.keys[j] = keys[i]
+			self.values[j] = values[i]
+			self.used[j] = true
+		}
+	}
+}
+
+// Find the slot for key: either the one holding it or the
+// empty one where it would go. There always is an empty
+// slot since the load stays below one.
+func (self *IntMap) find(key uint64) int {
+//	fmt.Printf("find %d\n", key)
+	mask := len(self.keys) - 1
+	i := self.home(key)
+	for self.used[i] && self.keys[i] != key {
+		i = (i + 1) & mask
+	}
+	return i
+}
+
+// Init initializes or clears an IntMap.
+func (self *IntMap) Init() *IntMap {
+//	fmt.Printf("Init %s\n", self)
+	self.alloc(intMinimumSize)
+	self.count = 0
+	self.grows = 0
+	self.shrinks = 0
+	return self
+}
+
+// NewInt returns an initialized IntMap.
+func NewInt() *IntMap {
+//	fmt.Printf("NewInt\n")
+	return new(IntMap).Init()
+}
+
+func (self *IntMap) Insert(key uint64, value uint64) {
+//	fmt.Printf("Insert %d->%d\n", key, value)
+	if self.loadFactor() >= intLoadGrow {
+		self.resize(len(self.keys) * 2)
+	}
+
+	i := self.find(key)
+	if self.used[i] {
+		panic("IntMap.Insert: duplicate key")
+	}
+	self.keys[i] = key
+	self.values[i] = value
+	self.used[i] = true
+	self.count++
+}
+
+// Remove shifts later pairs of the probe run back into the
+// hole instead of leaving a tombstone.
+func (self *IntMap) Remove(key uint64) {
+//	fmt.Printf("Remove %d\n", key)
+	i := self.find(key)
+	if !self.used[i] {
+		panic("IntMap.Remove: key not found")
+	}
+
+	mask := len(self.keys) - 1
+	for j := (i + 1) & mask; self.used[j]; j = (j + 1) & mask {
+		// move j into the hole at i unless its home
+		// lies cyclically in (i, j]
+		h := self.home(self.keys[j])
+		if (j > i && (h <= i || h > j)) || (j < i && h <= i && h > j) {
+			self.keys[i] = self.keys[j]
+			self.values[i] = self.values[j]
+			i = j
+		}
+	}
+	self.used[i] = false
+	self.count--
+
+	if len(self.keys) > intMinimumSize && self.loadFactor() <= intLoadShrink {
+		self.resize(len(self.keys) / 2)
+	}
+}
+
+func (self *IntMap) At(key uint64) uint64 {
+//	fmt.Printf("At %d\n", key)
+	i := self.find(key)
+	if !self.used[i] {
+		panic("IntMap.At: key not found")
+	}
+	return self.values[i]
+}
+
+func (self *IntMap) Set(key uint64, value uint64) {
+//	fmt.Printf("Set %d->%d\n", key, value)
+	i := self.find(key)
+	if !self.used[i] {
+		panic("IntMap.Set: key not found")
+	}
+	self.values[i] = value
+}
+
+func (self *IntMap) Has(key uint64) bool {
+//	fmt.Printf("Has %d\n", key)
+	return self.used[self.find(key)]
+}
+
+func (self *IntMap) Len() int {
+//	fmt.Printf("Len %d\n", self.count)
+	return self.count
+}
+
+func (self *IntMap) Do(f func(key uint64, value uint64)) {
+//	fmt.Printf("Do %s\n", f)
+	for i, u := range self.used {
+		if u {
+			f(self.keys[i], self.values[i])
+		}
+	}
+}
+
+// Range calls f for every pair until f returns false.
+func (self *IntMap) Range(f func(key uint64, value uint64) bool) {
+//	fmt.Printf("Range %s\n", f)
+	for i, u := range self.used {
+		if u && !f(self.keys[i], self.values[i]) {
+			return
+		}
+	}
+}
+
+// Stats describes the table; Grows and Shrinks count the
+// rehashes since Init().
+func (self *IntMap) Stats() Stats {
+//	fmt.Printf("Stats\n")
+	var s Stats
+	s.Buckets = len(self.keys)
+	s.Entries = self.count
+	s.LoadFactor = self.loadFactor()
+	s.Bytes = int(unsafe.Sizeof(*self)) + len(self.keys)*int(2*unsafe.Sizeof(uint64(0))+unsafe.Sizeof(false))
+	mask := len(self.keys) - 1
+	for i, u := range self.used {
+		if u {
+			s.ProbeLengths = histogram(s.ProbeLengths, (i-self.home(self.keys[i]))&mask)
+		}
+	}
+	s.Grows = self.grows
+	s.Shrinks = self.shrinks
+	return s
+}
+
+// Dump writes '#' for every used and '.' for every free
+// slot to w.
+func (self *IntMap) Dump(w io.Writer) {
+//	fmt.Printf("Dump\n")
+	dump(w, self.Stats(), func(i int) byte {
+		if self.used[i] {
+			return '#'
+		}
+		return '.'
+	})
+}
@@ -0,0 +1,141 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "fmt"
+import "rand"
+import "runtime"
+import "testing"
+
+func TestIntMapRandom(t *testing.T) {
+	const N = 100000
+	const S = 1000
+	m := NewInt()
+	shadow := make(map[uint64]uint64)
+	for i := 0; i < N; i++ {
+		k := uint64(rand.Intn(S))
+		_, ok := shadow[k]
+		if m.Has(k) != ok {
+			t.Fatalf("Has(%d) is %v, expected %v", k, !ok, ok)
+		}
+		switch {
+		case !ok:
+			m.Insert(k, uint64(i))
+			shadow[k] = uint64(i)
+		case i%2 == 0:
+			m.Remove(k)
+			shadow[k] = 0, false
+		default:
+			if m.At(k) != shadow[k] {
+				t.Fatalf("At(%d) is %d, expected %d", k, m.At(k), shadow[k])
+			}
+			m.Set(k, uint64(i))
+			shadow[k] = uint64(i)
+		}
+	}
+	if m.Len() != len(shadow) {
+		t.Errorf("expected %d, got %d", len(shadow), m.Len())
+	}
+	m.Do(func(key uint64, value uint64) {
+		if shadow[key] != value {
+			t.Errorf("Do saw %d->%d, expected %d", key, value, shadow[key])
+		}
+	})
+}
+
+func TestIntMapRemoveAll(t *testing.T) {
+	const Len = 10000
+	m := NewInt()
+	for i := 0; i < Len; i++ {
+		m.Insert(uint64(i)<<32, uint64(i))
+	}
+	for i := 0; i < Len; i++ {
+		m.Remove(uint64(i) << 32)
+		if i+1 < Len && !m.Has(uint64(i+1)<<32) {
+			t.Fatalf("removing %d lost %d", i, i+1)
+		}
+	}
+	if m.Len() != 0 || len(m.keys) != intMinimumSize {
+		t.Errorf("expected empty minimum table, got %d in %d", m.Len(), len(m.keys))
+	}
+}
+
+func BenchmarkIntMapInsert(b *testing.B) {
+	b.StopTimer()
+	m := NewInt()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		m.Insert(uint64(i), 1)
+	}
+}
+
+func BenchmarkIntMapAt(b *testing.B) {
+	b.StopTimer()
+	m := NewInt()
+	for i := 0; i < b.N; i++ {
+		m.Insert(uint64(i), 1)
+	}
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		m.At(uint64(i))
+	}
+}
+
+// The GC benchmarks time a full collection with a map of
+// ten million pairs alive; the time is dominated by
+// scanning the map, if it has to be scanned at all.
+// Besides ns/op they print the GC pause per collection and
+// the heap the map takes.
+
+const gcPairs = 10000000
+
+// Keeps the map reachable while collecting.
+var gcLive interface{}
+
+func heapAlloc() uint64 {
+	runtime.GC()
+	return runtime.MemStats.Alloc
+}
+
+// Total GC pause so far and the number of collections.
+func gcPauses() (uint64, uint32) {
+	return runtime.MemStats.PauseTotalNs, runtime.MemStats.NumGC
+}
+
+// Collect b.N times with live reachable; heap is what live takes.
+func benchmarkGC(b *testing.B, name string, live interface{}, heap uint64) {
+	gcLive = live
+	pause, n := gcPauses()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+	}
+	b.StopTimer()
+	pause2, n2 := gcPauses()
+	gcLive = nil
+	if n2 > n {
+		fmt.Printf("%s: %d bytes, %d ns pause per collection\n", name, heap, (pause2-pause)/uint64(n2-n))
+	}
+}
+
+func BenchmarkGCIntMap(b *testing.B) {
+	b.StopTimer()
+	before := heapAlloc()
+	m := NewInt()
+	for i := 0; i < gcPairs; i++ {
+		m.Insert(uint64(i), uint64(i))
+	}
+	benchmarkGC(b, "IntMap", m, heapAlloc()-before)
+}
+
+func BenchmarkGCHashMap(b *testing.B) {
+	b.StopTimer()
+	before := heapAlloc()
+	m := New()
+	for i := 0; i < gcPairs; i++ {
+		m.Insert(Integer(i), i)
+	}
+	benchmarkGC(b, "HashMap", m, heapAlloc()-before)
+}
@@ -0,0 +1,64 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "reflect"
+
+// Keys of different types are never equal, and their Equal
+// methods mostly assume they get their own type, so the maps
+// check that first. This is on the path of every lookup: the
+// key types of this package are told apart by a type switch,
+// only other types need reflect.
+func sameType(a, b Hashable) bool {
+	switch a.(type) {
+	case Int:
+		_, ok := b.(Int)
+		return ok
+	case String:
+		_, ok := b.(String)
+		return ok
+	}
+	switch b.(type) {
+	case Int, String:
+		return false
+	}
+	return reflect.Typeof(a) == reflect.Typeof(b)
+}
+
+// Whether two keys are equal, whatever their types.
+func keysEqual(a, b Hashable) bool {
+	return sameType(a, b) && a.Equal(b)
+}
+
+// Int is an int key whose Equal is safe to call with other
+// key types, just like String's.
+type Int int
+
+func (self Int) Hash() uint { return uint(self) }
+
+func (self Int) Equal(other Hashable) bool {
+	o, ok := other.(Int)
+	return ok && self == o
+}
+
+// String is a string key. The chained HashMap can look
+// Strings up by a []byte, see AtBytes and HasBytes, without
+// converting it and boxing it into a Hashable first.
+type String string
+
+// Hash is Bernstein's djb2 over the runes of the string.
+func (self String) Hash() uint {
+	var h uint = 5381
+	// explicit for loop is slower than range
+	for _, r := range self {
+		h = (h << 5) + h + uint(r)
+	}
+	return h
+}
+
+func (self String) Equal(other Hashable) bool {
+	s, ok := other.(String)
+	return ok && self == s
+}
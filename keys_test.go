@@ -0,0 +1,65 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "testing"
+
+// Int(i*i) has the same hash as Integer(i), Int(h) the same
+// as a String with hash h, so every key collides with one of
+// another type, and Integer's Equal panics on the others.
+func TestMixedKeys(t *testing.T) {
+	for _, n := range []int{smallSize / 4, 1000} {
+		a := New()
+		for i := 0; i < n; i++ {
+			s := String(keyName(i))
+			a.Insert(Integer(i), 1)
+			a.Insert(Int(i*i), 2)
+			a.Insert(s, 3)
+			a.Insert(Int(s.Hash()), 4)
+		}
+		for i := 0; i < n; i += 2 {
+			a.Remove(Integer(i))
+			a.Remove(String(keyName(i)))
+		}
+		for i := 0; i < n; i++ {
+			s := String(keyName(i))
+			if a.Has(Integer(i)) != (i%2 == 1) || a.Has(s) != (i%2 == 1) {
+				t.Errorf("%d: Remove got the wrong key", i)
+			}
+			if i%2 == 1 && (a.At(Integer(i)).(int) != 1 || a.At(s).(int) != 3) {
+				t.Errorf("%d: At got the wrong key", i)
+			}
+			if a.At(Int(i*i)).(int) != 2 || a.At(Int(s.Hash())).(int) != 4 {
+				t.Errorf("%d: Int keys lost", i)
+			}
+		}
+	}
+}
+
+// Trees only hold keys of one type, keys of others turn
+// them back into plain chains.
+func TestMixedTrees(t *testing.T) {
+	const Len = 100
+	var v hashVector
+	var nodes slab
+	for i := 0; i < Len; i++ {
+		v.add(&nodes, HashPair{orderedCollider(i), i})
+	}
+	if v.find(&nodes, Integer(1)) != -1 || v.tree == nil {
+		t.Errorf("Integer found in a tree of orderedColliders")
+	}
+	v.add(&nodes, HashPair{Integer(1), -1})
+	if v.tree != nil {
+		t.Errorf("tree holds an Integer")
+	}
+	if p := v.find(&nodes, Integer(1)); p == -1 || nodes.at(p).pair.Value.(int) != -1 {
+		t.Errorf("Integer lost")
+	}
+	for i := 0; i < Len; i++ {
+		if p := v.find(&nodes, orderedCollider(i)); p == -1 || nodes.at(p).pair.Value.(int) != i {
+			t.Errorf("%d lost", i)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+//import "fmt"
+import "io"
+
+// Pairs of a LinkedHashMap are threaded onto a circular
+// list through the map's sentinel node.
+type linkedPair struct {
+	HashPair
+	prev, next *linkedPair
+}
+
+// LinkedHashMap is a HashMap that iterates in insertion
+// order, or in access order if SetAccessOrder(true) was
+// called. Resizing the table doesn't change the order.
+// You must call Init() before using it.
+type LinkedHashMap struct {
+	m		HashMap // key -> *linkedPair
+	head		linkedPair // sentinel, head.next is first
+	accessOrder	bool
+}
+
+func (self *linkedPair) unlink() {
+	self.prev.next = self.next
+	self.next.prev = self.prev
+}
+
+// Link p in right after self.
+func (self *linkedPair) linkAfter(p *linkedPair) {
+	p.prev = self
+	p.next = self.next
+	self.next.prev = p
+	self.next = p
+}
+
+func (self *LinkedHashMap) find(key Hashable) *linkedPair {
+	if !self.m.Has(key) {
+		return nil
+	}
+	return self.m.At(key).(*linkedPair)
+}
+
+func (self *LinkedHashMap) access(p *linkedPair) {
+	if self.accessOrder {
+		p.unlink()
+		self.head.prev.linkAfter(p)
+	}
+}
+
+// Init initializes or clears a LinkedHashMap.
+func (self *LinkedHashMap) Init() *LinkedHashMap {
+//	fmt.Printf("Init %s\n", self)
+	self.m.Init()
+	self.head.prev = &self.head
+	self.head.next = &self.head
+	return self
+}
+
+// NewLinked returns an initialized linked hashmap.
+func NewLinked() *LinkedHashMap {
+//	fmt.Printf("NewLinked\n")
+	return new(LinkedHashMap).Init()
+}
+
+// SetAccessOrder makes At and Set move the pair they touch
+// to the back, so iteration runs from least to most recently
+// used. It doesn't reorder existing pairs.
+func (self *LinkedHashMap) SetAccessOrder(on bool) {
+	self.accessOrder = on
+}
+
+// Insert adds a pair at the back.
+func (self *LinkedHashMap) Insert(key Hashable, value interface{}) {
+//	fmt.Printf("Insert %s->%s\n", key, value)
+	p := &linkedPair{HashPair: HashPair{key, value}}
+	self.m.Insert(key, p)
+	self.head.prev.linkAfter(p)
+}
+
+func (self *LinkedHashMap) Remove(key Hashable) {
+//	fmt.Printf("Remove %s\n", key)
+	p := self.find(key)
+	if p == nil {
+		panic("LinkedHashMap.Remove: key not found")
+	}
+	self.m.Remove(key)
+	p.unlink()
+}
+
+func (self *LinkedHashMap) At(key Hashable) interface{} {
+//	fmt.Printf("At %s\n", key)
+	p := self.find(key)
+	if p == nil {
+		panic("LinkedHashMap.At: key not found")
+	}
+	self.access(p)
+	return p.Value
+}
+
+// Set replaces the value for key; the pair keeps its place
+// unless the map is in access order.
+func (self *LinkedHashMap) Set(key Hashable, value interface{}) {
+//	fmt.Printf("Set %s->%s\n", key, value)
+	p := self.find(key)
+	if p == nil {
+		panic("LinkedHashMap.Set: key not found")
+	}
+	p.Value = value
+	self.access(p)
+}
+
+func (self *LinkedHashMap) Has(key Hashable) bool {
+//	fmt.Printf("Has %s\n", key)
+	return self.m.Has(key)
+}
+
+func (self *LinkedHashMap) Len() int {
+//	fmt.Printf("Len %d\n", self.m.Len())
+	return self.m.Len()
+}
+
+// Stats describes the underlying HashMap; the links between
+// the pairs are part of its values.
+func (self *LinkedHashMap) Stats() Stats {
+//	fmt.Printf("Stats\n")
+	return self.m.Stats()
+}
+
+// Dump writes the chains of the underlying HashMap to w.
+func (self *LinkedHashMap) Dump(w io.Writer) {
+//	fmt.Printf("Dump\n")
+	self.m.Dump(w)
+}
+
+// First returns the pair at the front, panics if the map
+// is empty.
+func (self *LinkedHashMap) First() HashPair {
+	if self.head.next == &self.head {
+		panic("LinkedHashMap.First: empty map")
+	}
+	return self.head.next.HashPair
+}
+
+// Last returns the pair at the back, panics if the map
+// is empty.
+func (self *LinkedHashMap) Last() HashPair {
+	if self.head.prev == &self.head {
+		panic("LinkedHashMap.Last: empty map")
+	}
+	return self.head.prev.HashPair
+}
+
+func (self *LinkedHashMap) MoveToFront(key Hashable) {
+//	fmt.Printf("MoveToFront %s\n", key)
+	p := self.find(key)
+	if p == nil {
+		panic("LinkedHashMap.MoveToFront: key not found")
+	}
+	p.unlink()
+	self.head.linkAfter(p)
+}
+
+func (self *LinkedHashMap) MoveToBack(key Hashable) {
+//	fmt.Printf("MoveToBack %s\n", key)
+	p := self.find(key)
+	if p == nil {
+		panic("LinkedHashMap.MoveToBack: key not found")
+	}
+	p.unlink()
+	self.head.prev.linkAfter(p)
+}
+
+// Do calls f for every pair from front to back. It doesn't
+// count as an access.
+func (self *LinkedHashMap) Do(f func(key Hashable, value interface{})) {
+//	fmt.Printf("Do %s\n", f)
+	for p := self.head.next; p != &self.head; p = p.next {
+		f(p.Key, p.Value)
+	}
+}
+
+// DoReverse calls f for every pair from back to front.
+func (self *LinkedHashMap) DoReverse(f func(key Hashable, value interface{})) {
+//	fmt.Printf("DoReverse %s\n", f)
+	for p := self.head.prev; p != &self.head; p = p.prev {
+		f(p.Key, p.Value)
+	}
+}
+
+func (self *LinkedHashMap) iterate(c chan<- interface{}, reverse bool) {
+//	fmt.Printf("Iterate %s\n", c)
+	if reverse {
+		for p := self.head.prev; p != &self.head; p = p.prev {
+			c <- p.HashPair
+		}
+	} else {
+		for p := self.head.next; p != &self.head; p = p.next {
+			c <- p.HashPair
+		}
+	}
+	close(c)
+}
+
+// Iter yields HashPairs from front to back.
+func (self *LinkedHashMap) Iter() <-chan interface{} {
+//	fmt.Printf("Iter\n")
+	c := make(chan interface{})
+	go self.iterate(c, false)
+	return c
+}
+
+// IterReverse yields HashPairs from back to front.
+func (self *LinkedHashMap) IterReverse() <-chan interface{} {
+//	fmt.Printf("IterReverse\n")
+	c := make(chan interface{})
+	go self.iterate(c, true)
+	return c
+}
@@ -0,0 +1,82 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "testing"
+
+func TestLinkedOrder(t *testing.T) {
+	const Len = 1000
+	m := NewLinked()
+	// descending keys, so bucket order can't match by accident
+	for i := Len; i > 0; i-- {
+		m.Insert(Integer(i), i)
+	}
+	for i := Len; i > 0; i -= 2 {
+		m.Remove(Integer(i))
+	}
+	next := Len - 1
+	m.Do(func(key Hashable, value interface{}) {
+		if key.(Integer) != Integer(next) {
+			t.Errorf("Do expected %d, got %d", next, key)
+		}
+		next -= 2
+	})
+	next = 1
+	for v := range m.IterReverse() {
+		p := v.(HashPair)
+		if p.Key.(Integer) != Integer(next) {
+			t.Errorf("IterReverse expected %d, got %d", next, p.Key)
+		}
+		next += 2
+	}
+	if m.First().Key.(Integer) != Len-1 || m.Last().Key.(Integer) != 1 {
+		t.Errorf("expected first %d and last 1, got %d and %d", Len-1, m.First().Key, m.Last().Key)
+	}
+}
+
+func TestLinkedMove(t *testing.T) {
+	m := NewLinked()
+	for i := 0; i < 5; i++ {
+		m.Insert(Integer(i), i)
+	}
+	m.MoveToFront(Integer(3))
+	m.MoveToBack(Integer(0))
+	expected := []Integer{3, 1, 2, 4, 0}
+	i := 0
+	for v := range m.Iter() {
+		if k := v.(HashPair).Key.(Integer); k != expected[i] {
+			t.Errorf("position %d: expected %d, got %d", i, expected[i], k)
+		}
+		i++
+	}
+}
+
+func TestLinkedAccessOrder(t *testing.T) {
+	m := NewLinked()
+	m.SetAccessOrder(true)
+	for i := 0; i < 3; i++ {
+		m.Insert(Integer(i), i)
+	}
+	m.At(Integer(0))
+	m.Set(Integer(1), 10)
+	if m.First().Key.(Integer) != 2 || m.Last().Key.(Integer) != 1 {
+		t.Errorf("expected first 2 and last 1, got %d and %d", m.First().Key, m.Last().Key)
+	}
+}
+
+func TestLinkedStats(t *testing.T) {
+	const Len = 1000
+	m := NewLinked()
+	for i := 0; i < 2*Len; i++ {
+		m.Insert(Integer(i), i)
+	}
+	for i := 0; i < 2*Len; i += 2 {
+		m.Remove(Integer(i))
+	}
+	s := m.Stats()
+	if s.Entries != Len || s.Buckets != len(m.m.data) || s.Grows == 0 {
+		t.Errorf("expected the Stats of the HashMap, got %v", s)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+//import "fmt"
+import "io"
+import "unsafe"
+
+// MultiMap is a HashMap that allows repeated keys.
+// Values for the same key are kept next to each other
+// in their bucket, in the order they were put.
+// You must call Init() before using it.
+type MultiMap struct {
+	data	[]hashVector // each should be short
+	nodes	slab // all chains live here
+	count	int // to compute load factor
+	grows	int // for Stats()
+	shrinks	int
+}
+
+// Find the run of pairs for key in bucket v, returns the
+// node before it (0 if the run starts the chain), its first
+// node and its length; if key is not in v they are all 0.
+func (self *hashVector) run(s *slab, key Hashable) (prev int, start int, n int) {
+	for i := self.head; i != 0; prev, i = i, s.at(i).next {
+		if keysEqual(key, s.at(i).pair.Key) {
+			for start = i; i != 0 && keysEqual(key, s.at(i).pair.Key); i = s.at(i).next {
+				n++
+			}
+			return prev, start, n
+		}
+	}
+	return 0, 0, 0
+}
+
+func (self *MultiMap) loadFactor() float {
+//	fmt.Printf("loadFactor %d/%d\n", self.count, len(self.data))
+	return float(self.count) / float(len(self.data))
+}
+
+// Runs stay contiguous and in order because a chain is
+// relinked in order, each node at the end of its new chain,
+// and all pairs of a run land in the same new bucket.
+func (self *MultiMap) rehashInto(data []hashVector) {
+//	fmt.Printf("rehashInto %d\n", len(data))
+	l := uint(len(data))
+	tails := make([]int, len(data))
+	for b := range self.data {
+		for i := self.data[b].head; i != 0; {
+			n := self.nodes.write(i)
+			next := n.next
+			h := n.pair.Key.Hash() % l
+			n.next = 0
+			if tails[h] == 0 {
+				data[h].head = i
+			} else {
+				self.nodes.write(tails[h]).next = i
+			}
+			tails[h] = i
+			data[h].count++
+			i = next
+		}
+	}
+}
+
+func (self *MultiMap) grow() {
+//	fmt.Printf("grow\n")
+	d := make([]hashVector, len(self.data)*2)
+	self.rehashInto(d)
+	self.data = d
+	self.grows++
+}
+
+func (self *MultiMap) shrink() {
+//	fmt.Printf("shrink\n")
+	if len(self.data) <= 8 {
+		return
+	}
+	d := make([]hashVector, len(self.data)/2)
+	self.rehashInto(d)
+	self.data = d
+	self.shrinks++
+}
+
+func (self *MultiMap) bucket(key Hashable) *hashVector {
+	return &self.data[key.Hash()%uint(len(self.data))]
+}
+
+// Init initializes or clears a MultiMap.
+func (self *MultiMap) Init() *MultiMap {
+//	fmt.Printf("Init %s\n", self)
+	self.data = make([]hashVector, 8)
+	self.nodes = slab{}
+	self.count = 0
+	self.grows = 0
+	self.shrinks = 0
+	return self
+}
+
+// NewMulti returns an initialized multimap.
+func NewMulti() *MultiMap {
+//	fmt.Printf("NewMulti\n")
+	return new(MultiMap).Init()
+}
+
+// Put adds value under key, after any values already there.
+func (self *MultiMap) Put(key Hashable, value interface{}) {
+//	fmt.Printf("Put %s->%s\n", key, value)
+	if self.loadFactor() >= loadGrow {
+		self.grow()
+	}
+
+	v := self.bucket(key)
+	_, last, n := v.run(&self.nodes, key)
+	if n == 0 {
+		v.push(&self.nodes, HashPair{key, value})
+	} else {
+		for ; n > 1; n-- {
+			last = self.nodes.at(last).next
+		}
+		v.insertAfter(&self.nodes, last, HashPair{key, value})
+	}
+	self.count++
+}
+
+// GetAll returns the values for key in the order they were
+// put, or nil if there are none.
+func (self *MultiMap) GetAll(key Hashable) []interface{} {
+//	fmt.Printf("GetAll %s\n", key)
+	_, i, n := self.bucket(key).run(&self.nodes, key)
+	if n == 0 {
+		return nil
+	}
+	values := make([]interface{}, n)
+	for j := range values {
+		values[j] = self.nodes.at(i).pair.Value
+		i = self.nodes.at(i).next
+	}
+	return values
+}
+
+// RemoveOne removes the first pair with the given key and
+// value. Values are compared with ==, so they have to be of
+// comparable types; a slice or a map value panics.
+func (self *MultiMap) RemoveOne(key Hashable, value interface{}) {
+//	fmt.Printf("RemoveOne %s->%s\n", key, value)
+	v := self.bucket(key)
+	prev, i, n := v.run(&self.nodes, key)
+	for ; n > 0; prev, i, n = i, self.nodes.at(i).next, n-1 {
+		if self.nodes.at(i).pair.Value == value {
+			v.unlink(&self.nodes, prev, i)
+			self.count--
+			if self.loadFactor() <= loadShrink {
+				self.shrink()
+			}
+			return
+		}
+	}
+	panic("MultiMap.RemoveOne: pair not found")
+}
+
+// RemoveAll removes every value for key and returns how
+// many there were.
+func (self *MultiMap) RemoveAll(key Hashable) int {
+//	fmt.Printf("RemoveAll %s\n", key)
+	v := self.bucket(key)
+	prev, i, n := v.run(&self.nodes, key)
+	if n == 0 {
+		panic("MultiMap.RemoveAll: key not found")
+	}
+	for j := 0; j < n; j++ {
+		next := self.nodes.at(i).next
+		v.unlink(&self.nodes, prev, i) // frees the node
+		i = next
+	}
+	self.count -= n
+
+	if self.loadFactor() <= loadShrink {
+		self.shrink()
+	}
+	return n
+}
+
+// CountKey returns the number of values for key.
+func (self *MultiMap) CountKey(key Hashable) int {
+//	fmt.Printf("CountKey %s\n", key)
+	_, _, n := self.bucket(key).run(&self.nodes, key)
+	return n
+}
+
+func (self *MultiMap) Has(key Hashable) bool {
+//	fmt.Printf("Has %s\n", key)
+	return self.bucket(key).find(&self.nodes, key) != -1
+}
+
+// Len returns the number of pairs, not the number of keys.
+func (self *MultiMap) Len() int {
+//	fmt.Printf("Len %d\n", self.count)
+	return self.count
+}
+
+// Stats describes the table like HashMap's does; a run of
+// values counts as that many pairs.
+func (self *MultiMap) Stats() Stats {
+//	fmt.Printf("Stats\n")
+	var s Stats
+	s.Buckets = len(self.data)
+	s.Entries = self.count
+	s.LoadFactor = self.loadFactor()
+	s.Bytes = int(unsafe.Sizeof(*self)) + len(self.data)*int(unsafe.Sizeof(hashVector{})) +
+		self.nodes.size()*int(unsafe.Sizeof(slabNode{}))
+	for b := range self.data {
+		s.ChainLengths = histogram(s.ChainLengths, self.data[b].count)
+	}
+	s.Grows = self.grows
+	s.Shrinks = self.shrinks
+	return s
+}
+
+// Dump writes the length of every chain to w like HashMap's
+// Dump; a run of values counts as that many pairs.
+func (self *MultiMap) Dump(w io.Writer) {
+//	fmt.Printf("Dump\n")
+	dump(w, self.Stats(), func(i int) byte {
+		return chainCell(self.data[i].count)
+	})
+}
+
+func (self *MultiMap) Do(f func(key Hashable, value interface{})) {
+//	fmt.Printf("Do %s\n", f)
+	for b := range self.data {
+		for i := self.data[b].head; i != 0; i = self.nodes.at(i).next {
+			e := self.nodes.at(i).pair
+			f(e.Key, e.Value)
+		}
+	}
+}
+
+func (self *MultiMap) iterate(c chan<- interface{}) {
+//	fmt.Printf("Iterate %s\n", c)
+	for b := range self.data {
+		for i := self.data[b].head; i != 0; i = self.nodes.at(i).next {
+			c <- self.nodes.at(i).pair
+		}
+	}
+	close(c)
+}
+
+// Iter yields a HashPair for every (key, value) pair.
+func (self *MultiMap) Iter() <-chan interface{} {
+//	fmt.Printf("Iter\n")
+	c := make(chan interface{})
+	go self.iterate(c)
+	return c
+}
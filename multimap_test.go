@@ -0,0 +1,162 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "bytes"
+import "testing"
+
+func TestMultiPut(t *testing.T) {
+	const Len = 1000
+	const Rep = 3
+	m := NewMulti()
+	for r := 0; r < Rep; r++ {
+		for i := 0; i < Len; i++ {
+			m.Put(Integer(i), r)
+		}
+	}
+	if m.Len() != Len*Rep {
+		t.Errorf("expected %d, got %d", Len*Rep, m.Len())
+	}
+	for i := 0; i < Len; i++ {
+		if m.CountKey(Integer(i)) != Rep {
+			t.Errorf("expected %d values for %d, got %d", Rep, i, m.CountKey(Integer(i)))
+		}
+		for r, v := range m.GetAll(Integer(i)) {
+			if v.(int) != r {
+				t.Errorf("value %d for %d out of order: %d", r, i, v)
+			}
+		}
+	}
+}
+
+func TestMultiContiguous(t *testing.T) {
+	const Len = 1000
+	m := NewMulti()
+	// i and -i collide, interleave them
+	for i := 1; i < Len; i++ {
+		m.Put(Integer(i), true)
+		m.Put(Integer(-i), true)
+		m.Put(Integer(i), false)
+	}
+	for b := range m.data {
+		seen := make(map[Hashable]bool)
+		var last Hashable
+		for i := m.data[b].head; i != 0; i = m.nodes.at(i).next {
+			key := m.nodes.at(i).pair.Key
+			if key != last && seen[key] {
+				t.Fatalf("run for %d not contiguous", key)
+			}
+			seen[key] = true
+			last = key
+		}
+	}
+	for i := 1; i < Len; i++ {
+		if v := m.GetAll(Integer(i)); len(v) != 2 || !v[0].(bool) || v[1].(bool) {
+			t.Fatalf("expected [true false] for %d, got %v", i, v)
+		}
+	}
+}
+
+func TestMultiRemove(t *testing.T) {
+	const Len = 1000
+	m := NewMulti()
+	for i := 0; i < Len; i++ {
+		m.Put(Integer(i), 1)
+		m.Put(Integer(i), 2)
+		m.Put(Integer(i), 3)
+	}
+	for i := 0; i < Len; i++ {
+		m.RemoveOne(Integer(i), 2)
+	}
+	for i := 0; i < Len; i++ {
+		v := m.GetAll(Integer(i))
+		if len(v) != 2 || v[0].(int) != 1 || v[1].(int) != 3 {
+			t.Errorf("expected [1 3] for %d, got %v", i, v)
+		}
+	}
+	for i := 0; i < Len; i++ {
+		if n := m.RemoveAll(Integer(i)); n != 2 {
+			t.Errorf("expected 2 removed for %d, got %d", i, n)
+		}
+	}
+	if m.Len() != 0 {
+		t.Errorf("expected 0, got %d", m.Len())
+	}
+	for i := 0; i < Len; i++ {
+		if m.Has(Integer(i)) {
+			t.Errorf("removed %d was found", i)
+		}
+	}
+}
+
+func TestMultiIter(t *testing.T) {
+	const Len = 100
+	m := NewMulti()
+	for i := 0; i < Len; i++ {
+		m.Put(Integer(i), i)
+		m.Put(Integer(i), -i)
+	}
+	i := 0
+	for v := range m.Iter() {
+		p := v.(HashPair)
+		if x := p.Value.(int); Integer(x) != p.Key && Integer(-x) != p.Key {
+			t.Error("Iter expected", p.Key, "got", x)
+		}
+		i++
+	}
+	if i != 2*Len {
+		t.Error("Iter stopped at", i, "not", 2*Len)
+	}
+}
+
+// RemoveAll must not keep the removed pairs reachable.
+func TestMultiRemoveAllClears(t *testing.T) {
+	m := NewMulti()
+	for i := 0; i < 5; i++ {
+		m.Put(Integer(1), i)
+		m.Put(Integer(-1), i) // same bucket, after the run
+	}
+	m.RemoveAll(Integer(1))
+	for i := m.nodes.free; i != 0; i = m.nodes.at(i).next {
+		if p := m.nodes.at(i).pair; p.Key != nil || p.Value != nil {
+			t.Errorf("free node %d still holds %v", i, p)
+		}
+	}
+	if m.CountKey(Integer(-1)) != 5 {
+		t.Errorf("expected 5 values left, got %d", m.CountKey(Integer(-1)))
+	}
+}
+
+func TestMultiStats(t *testing.T) {
+	const Len = 1000
+	m := NewMulti()
+	for i := 0; i < Len; i++ {
+		for j := 0; j < 3; j++ {
+			m.Put(Integer(i), j)
+		}
+	}
+	for i := 0; i < Len; i++ {
+		m.RemoveAll(Integer(i))
+	}
+	m.Put(Integer(0), 0)
+	m.Put(Integer(0), 1)
+	s := m.Stats()
+	buckets, pairs := 0, 0
+	for n, b := range s.ChainLengths {
+		buckets += b
+		pairs += n * b
+	}
+	if s.Entries != 2 || s.Buckets != len(m.data) || buckets != s.Buckets || pairs != 2 {
+		t.Errorf("Stats don't add up: %v", s)
+	}
+	if s.Grows == 0 || s.Shrinks == 0 || s.Bytes == 0 {
+		t.Errorf("expected the map to have grown and shrunk, got %v", s)
+	}
+	var b bytes.Buffer
+	m.Dump(&b)
+	if lines, expected := bytes.Count(b.Bytes(), []byte{'\n'}), 1+(s.Buckets+dumpWidth-1)/dumpWidth; lines != expected {
+		t.Errorf("Dump wrote %d lines, expected %d", lines, expected)
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+//import "fmt"
+
+// Observer is told about the changes to a HashMap it
+// observes, to keep indexes or metrics in step with it. The
+// funcs are called once the operation that made the changes
+// returns, in the order the changes were made; an operation
+// that panics tells nobody, not even about the changes it
+// did make. Any of the funcs can be nil.
+//
+// The funcs may change the map themselves. Those changes
+// wait until every observer has been told about the ones
+// before them, so all observers see all changes in the
+// order they were made, nested or not.
+type Observer struct {
+	OnInsert	func(key Hashable, value interface{})
+	OnSet		func(key Hashable, old, value interface{})
+	OnRemove	func(key Hashable, value interface{})
+	// Resizes, in buckets as Stats() counts them.
+	OnResize	func(oldBuckets, newBuckets int)
+}
+
+const (
+	insertChange	= iota
+	updateChange
+	removeChange
+	resizeChange
+)
+
+// One change an Observer hasn't been told about yet.
+type change struct {
+	kind		int
+	key		Hashable
+	old, value	interface{}
+	from, to	int // buckets
+}
+
+// The observers of a map and the changes it has made. Each
+// operation calls start() first and end() when it's done;
+// changes recorded in between are dropped if it panics.
+type observers struct {
+	list	[]*Observer // never changed in place
+	pending	[]change
+	done	int // pending[0:done] are from operations that returned
+	held	bool // by a Txn, until it commits; only this package has them
+	flushing	bool // in flush(), which gets to nested changes too
+}
+
+func (self *observers) add(o *Observer) {
+	l := make([]*Observer, len(self.list)+1)
+	copy(l, self.list)
+	l[len(self.list)] = o
+	self.list = l
+}
+
+func (self *observers) remove(o *Observer) {
+	for i, x := range self.list {
+		if x == o {
+			l := make([]*Observer, len(self.list)-1)
+			copy(l, self.list[0:i])
+			copy(l[i:], self.list[i+1:])
+			self.list = l
+			return
+		}
+	}
+	panic("HashMap.Unobserve: not observing")
+}
+
+func (self *observers) start() {
+	self.pending = self.pending[0:self.done]
+}
+
+func (self *observers) record(c change) {
+	if len(self.list) == 0 {
+		return
+	}
+	n := len(self.pending)
+	if n == cap(self.pending) {
+		p := make([]change, n, 2*n+4)
+		copy(p, self.pending)
+		self.pending = p
+	}
+	self.pending = self.pending[0 : n+1]
+	self.pending[n] = c
+}
+
+func (self *observers) inserted(key Hashable, value interface{}) {
+	self.record(change{kind: insertChange, key: key, value: value})
+}
+
+func (self *observers) updated(key Hashable, old, value interface{}) {
+	self.record(change{kind: updateChange, key: key, old: old, value: value})
+}
+
+func (self *observers) removed(key Hashable, value interface{}) {
+	self.record(change{kind: removeChange, key: key, value: value})
+}
+
+func (self *observers) resized(from, to int) {
+	self.record(change{kind: resizeChange, from: from, to: to})
+}
+
+func (self *observers) end() {
+	self.done = len(self.pending)
+	if !self.held {
+		self.flush()
+	}
+}
+
+// Tell the observers about all changes of operations that
+// returned. They may change the map while they're at it;
+// the changes they make are queued behind the batch being
+// told about, and the loop gets to them next.
+func (self *observers) flush() {
+	if self.flushing {
+		return
+	}
+	self.flushing = true
+	defer func() { self.flushing = false }()
+	for self.done > 0 {
+		p, list := self.pending[0:self.done], self.list
+		self.pending = nil
+		self.done = 0
+		for _, c := range p {
+			for _, o := range list {
+				switch {
+				case c.kind == insertChange && o.OnInsert != nil:
+					o.OnInsert(c.key, c.value)
+				case c.kind == updateChange && o.OnSet != nil:
+					o.OnSet(c.key, c.old, c.value)
+				case c.kind == removeChange && o.OnRemove != nil:
+					o.OnRemove(c.key, c.value)
+				case c.kind == resizeChange && o.OnResize != nil:
+					o.OnResize(c.from, c.to)
+				}
+			}
+		}
+	}
+}
+
+// Observe has o told about all changes to the map from now
+// on, until Unobserve(o).
+func (self *HashMap) Observe(o *Observer) {
+//	fmt.Printf("Observe %s\n", o)
+	self.watch.add(o)
+}
+
+func (self *HashMap) Unobserve(o *Observer) {
+//	fmt.Printf("Unobserve %s\n", o)
+	self.watch.remove(o)
+}
@@ -0,0 +1,183 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+// These tests only use what every map variant with
+// observers has: open/ and bucketlist/ have a symlink to
+// this file, like to variants_test.go.
+
+import "testing"
+
+// A secondary copy of a map of Int to int, kept up to date
+// by an Observer alone.
+type mirror struct {
+	t	*testing.T
+	shadow	map[Int]int
+	buckets	int
+	changes	int
+	resizes	int
+}
+
+func newMirror(t *testing.T, m *HashMap) *mirror {
+	self := &mirror{t, make(map[Int]int), m.Stats().Buckets, 0, 0}
+	m.Do(func(key Hashable, value interface{}) { self.shadow[key.(Int)] = value.(int) })
+	return self
+}
+
+func (self *mirror) observer() *Observer {
+	return &Observer{
+		OnInsert: func(key Hashable, value interface{}) {
+			k := key.(Int)
+			if _, ok := self.shadow[k]; ok {
+				self.t.Errorf("insert of %d, which is there", k)
+			}
+			self.shadow[k] = value.(int)
+			self.changes++
+		},
+		OnSet: func(key Hashable, old, value interface{}) {
+			k := key.(Int)
+			if v, ok := self.shadow[k]; !ok || v != old.(int) {
+				self.t.Errorf("set of %d from %d, expected from %d", k, old, v)
+			}
+			self.shadow[k] = value.(int)
+			self.changes++
+		},
+		OnRemove: func(key Hashable, value interface{}) {
+			k := key.(Int)
+			if v, ok := self.shadow[k]; !ok || v != value.(int) {
+				self.t.Errorf("remove of %d->%d, expected %d", k, value, v)
+			}
+			self.shadow[k] = 0, false
+			self.changes++
+		},
+		OnResize: func(oldBuckets, newBuckets int) {
+			if oldBuckets != self.buckets {
+				self.t.Errorf("resize from %d buckets, expected from %d", oldBuckets, self.buckets)
+			}
+			self.buckets = newBuckets
+			self.resizes++
+		},
+	}
+}
+
+func (self *mirror) check(what string, m *HashMap) {
+	if len(self.shadow) != m.Len() {
+		self.t.Errorf("%s: mirror has %d pairs, map %d", what, len(self.shadow), m.Len())
+	}
+	if b := m.Stats().Buckets; self.buckets != b {
+		self.t.Errorf("%s: mirror has %d buckets, map %d", what, self.buckets, b)
+	}
+	m.Do(func(key Hashable, value interface{}) {
+		if v, ok := self.shadow[key.(Int)]; !ok || v != value.(int) {
+			self.t.Errorf("%s: mirror lost %d->%d", what, key, value)
+		}
+	})
+}
+
+func TestObserve(t *testing.T) {
+	const Len = 1000
+	a := New()
+	a.Insert(Int(-1), -1)
+	m := newMirror(t, a)
+	a.Observe(m.observer())
+	for i := 0; i < Len; i++ {
+		a.Insert(Int(i), i)
+	}
+	m.check("after Insert", a)
+	for i := 0; i < Len; i += 2 {
+		a.Set(Int(i), -i)
+	}
+	m.check("after Set", a)
+	for i := 0; i < Len; i++ {
+		a.Remove(Int(i))
+	}
+	m.check("after Remove", a)
+	if m.changes != Len+Len/2+Len {
+		t.Errorf("expected %d changes, got %d", Len+Len/2+Len, m.changes)
+	}
+	a.Init()
+	m.check("after Init", a)
+}
+
+func TestUnobserve(t *testing.T) {
+	a := New()
+	m, n := newMirror(t, a), newMirror(t, a)
+	o := m.observer()
+	a.Observe(o)
+	a.Observe(n.observer())
+	a.Insert(Int(1), 1)
+	a.Unobserve(o)
+	a.Insert(Int(2), 2)
+	if m.changes != 1 || n.changes != 2 {
+		t.Errorf("expected 1 and 2 changes, got %d and %d", m.changes, n.changes)
+	}
+}
+
+// Nobody hears about operations that panic, not even about
+// the table they grew before panicking.
+func TestObserveNoPanics(t *testing.T) {
+	const Len = 100
+	a := New()
+	m := newMirror(t, a)
+	a.Observe(m.observer())
+	for i := 0; i < Len; i++ {
+		a.Insert(Int(i), i)
+		func() {
+			defer func() { recover() }()
+			a.Insert(Int(i/2), i) // duplicate
+		}()
+		func() {
+			defer func() { recover() }()
+			a.Remove(Int(Len))
+		}()
+		func() {
+			defer func() { recover() }()
+			a.Set(Int(Len), i)
+		}()
+	}
+	if m.changes != Len {
+		t.Errorf("expected %d changes, got %d", Len, m.changes)
+	}
+	m.check("after panics", a)
+}
+
+// Observers that change the map hear about their own changes
+// after the change they were told about, as do the others.
+func TestObserveNested(t *testing.T) {
+	a := New()
+	m := newMirror(t, a)
+	var first, second []int
+	log := func(l *[]int, k int) {
+		n := make([]int, len(*l)+1)
+		copy(n, *l)
+		n[len(*l)] = k
+		*l = n
+	}
+	a.Observe(&Observer{OnInsert: func(key Hashable, value interface{}) {
+		k := int(key.(Int))
+		log(&first, k)
+		if k < 4 {
+			a.Insert(Int(2*k+1), 0)
+			a.Insert(Int(2*k+2), 0)
+		}
+	}})
+	a.Observe(&Observer{OnInsert: func(key Hashable, value interface{}) {
+		log(&second, int(key.(Int)))
+	}})
+	a.Observe(m.observer())
+	a.Insert(Int(0), 0)
+	for _, l := range [][]int{first, second} {
+		if len(l) != 9 {
+			t.Fatalf("expected 9 inserts, got %v", l)
+		}
+		for i, k := range l {
+			if k != i {
+				t.Errorf("inserts out of order: %v", l)
+				break
+			}
+		}
+	}
+	m.check("after nested Insert", a)
+}
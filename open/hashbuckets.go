@@ -56,7 +56,7 @@ func (self bucketArray) find(key Hashable) (index int) {
 			}
 		case used:
 			// winner if keys match
-			if key.Equal(b.pair.Key) {
+			if keysEqual(key, b.pair.Key) {
 				// relocate from i to r if possible
 				if r != -1 {
 					d[r] = b
@@ -86,7 +86,9 @@ func (self bucketArray) find(key Hashable) (index int) {
 				// if we have a deleted one, return that
 				return r
 			} else {
-				// table full, should never happen
+				// table full, can't happen since HashMap
+				// rehashes before the last fresh bucket
+				// goes
 				panic("bucketArray.find: table full")
 			}
 		}
@@ -97,20 +99,24 @@ func (self bucketArray) find(key Hashable) (index int) {
 	return -1
 }
 
-func (self bucketArray) push(key Hashable, value interface{}) bool {
+// Push a pair unless the key is there already. Returns the
+// state the bucket had before, so used means it failed.
+func (self bucketArray) push(key Hashable, value interface{}) int {
 	p := self.find(key)
-	if self.data[p].state == used {
-		return false
+	old := self.data[p].state
+	if old != used {
+		self.data[p] = bucket{HashPair{key, value}, used}
 	}
-	self.data[p] = bucket{HashPair{key, value}, used}
-	return true
+	return old
 }
 
-func (self bucketArray) pop(key Hashable) bool {
+// Delete the pair for key and return it, if there is one.
+func (self bucketArray) pop(key Hashable) (pair HashPair, ok bool) {
 	p := self.find(key)
 	if self.data[p].state != used {
-		return false
+		return
 	}
+	pair = self.data[p].pair
 	self.data[p] = deletedBucket
-	return true
+	return pair, true
 }
@@ -6,21 +6,23 @@
 package hashmap
 
 //import "fmt"
+import "container/hashmap/sizing"
+import "io"
+import "unsafe"
 
 const loadGrow = 0.5
 const loadShrink = 0.1
 
-// Some primes close to powers of 2 for the table sizes
-// (except for 7 all are greater than the nearest 2**i)
-var primes = []uint{
-	7, 17, 37, 67, 131, 257, 521, 1031, 2053, 4099, 8209, 16411,
-	32771, 65537, 131101, 262147, 524309, 1048583, 2097169,
-	4194319, 8388617, 16777259, 33554467, 67108879, 134217757,
-	268435459, 536870923, 1073741827, 2147483659,
-}
+// Deleted buckets don't count towards the load, but they do
+// make probe runs longer; rehash in place once used and
+// deleted ones together fill this much of the table, so
+// there are always fresh buckets to end a probe run.
+const loadDirty = 0.75
 
-// Size we start out with and never go below
-var minimumSize = primes[0]
+// Shrink only if the smaller table is at most this fraction
+// of loadGrow full, so the next few inserts don't grow it
+// right back, whatever steps the size policy takes.
+const hysteresis = 0.5
 
 // Hashable is an interface that keys have to implement.
 type Hashable interface {
@@ -33,7 +35,13 @@ type Hashable interface {
 type HashMap struct {
 	buckets bucketArray
 	count int // to compute load factor
-	prime int
+	deleted int // buckets left deleted by Remove
+	policy sizing.SizePolicy // table sizes
+	reserved int // never shrink below room for this many
+	autoShrink bool
+	grows int // for Stats()
+	shrinks int
+	watch observers
 }
 
 // HashPair is a key and a value.
@@ -48,6 +56,11 @@ func (self *HashMap) loadFactor() float {
 	return float(self.count) / float(len(self.buckets.data))
 }
 
+// How much of the table is used or deleted.
+func (self *HashMap) dirtyFactor() float {
+	return float(self.count+self.deleted) / float(len(self.buckets.data))
+}
+
 func (self *HashMap) rehashInto(dest bucketArray) {
 //	fmt.Printf("rehashInto %d\n", len(data))
 	for _, b := range self.buckets.data {
@@ -57,43 +70,88 @@ func (self *HashMap) rehashInto(dest bucketArray) {
 	}
 }
 
-func (self *HashMap) grow() {
-//	fmt.Printf("grow\n")
-	p := self.prime
-	if p == len(primes)-1 {
-		panic("grow: can't grow bigger!")
-	}
-	p++
-
+func (self *HashMap) resize(size uint64) {
+//	fmt.Printf("resize %d\n", size)
 	var newBuckets bucketArray
-	newBuckets.data = make([]bucket, primes[p])
+	newBuckets.data = make([]bucket, size)
 	self.rehashInto(newBuckets)
+	if int(size) != len(self.buckets.data) {
+		self.watch.resized(len(self.buckets.data), int(size))
+	}
 	self.buckets = newBuckets
+	self.deleted = 0
+}
 
-	self.prime = p
+func (self *HashMap) grow() {
+//	fmt.Printf("grow\n")
+	s := self.policy.Grow(uint64(len(self.buckets.data)))
+	if s == 0 {
+		panic("grow: can't grow bigger!")
+	}
+	self.resize(s)
+	self.grows++
 }
 
 func (self *HashMap) shrink() {
 //	fmt.Printf("shrink\n")
-	p := self.prime
-	if p == 0 {
+	s := self.policy.Shrink(uint64(len(self.buckets.data)))
+	if s == uint64(len(self.buckets.data)) || s < self.tableSize(self.reserved) {
+		return
+	}
+	if float(self.count) >= float(s)*loadGrow*hysteresis {
 		return
 	}
-	p--
+	self.resize(s)
+	self.shrinks++
+}
 
-	var newBuckets bucketArray
-	newBuckets.data = make([]bucket, primes[p])
-	self.rehashInto(newBuckets)
-	self.buckets = newBuckets
+// Smallest table that holds n pairs without growing.
+func (self *HashMap) tableSize(n int) uint64 {
+	s := sizing.Fit(self.policy, uint64(n), loadGrow)
+	if s == 0 {
+		panic("tableSize: can't grow bigger!")
+	}
+	return s
+}
 
-	self.prime = p
+// The size to rebuild at: room for the pairs with the same
+// slack that shrink() leaves, and for what was reserved.
+func (self *HashMap) idealSize() uint64 {
+	n := int(float(self.count) / hysteresis)
+	if n < self.reserved {
+		n = self.reserved
+	}
+	return self.tableSize(n)
 }
 
-// Init initializes or clears a HashMap.
+// Init initializes or clears a HashMap, sizing its table
+// with primes close to powers of two.
 func (self *HashMap) Init() *HashMap {
-//	fmt.Printf("Init %s\n", self)
-	self.buckets.data = make([]bucket, 8)
+	return self.InitWithPolicy(sizing.PrimesNearPowers)
+}
+
+// InitWithPolicy initializes or clears a HashMap that sizes
+// its table according to p. Prime sizes spread weak hashes
+// best.
+func (self *HashMap) InitWithPolicy(p sizing.SizePolicy) *HashMap {
+//	fmt.Printf("InitWithPolicy %s\n", self)
+	self.watch.start()
+	if len(self.watch.list) > 0 {
+		// clearing, the observers see everything go
+		self.Do(func(key Hashable, value interface{}) { self.watch.removed(key, value) })
+		if self.buckets.data != nil && uint64(len(self.buckets.data)) != p.Initial() {
+			self.watch.resized(len(self.buckets.data), int(p.Initial()))
+		}
+	}
+	self.policy = p
+	self.reserved = 0
+	self.autoShrink = true
+	self.buckets.data = make([]bucket, p.Initial())
 	self.count = 0
+	self.deleted = 0
+	self.grows = 0
+	self.shrinks = 0
+	self.watch.end()
 	return self
 }
 
@@ -103,28 +161,55 @@ func New() *HashMap {
 	return new(HashMap).Init()
 }
 
+// NewWithPolicy returns an initialized hashmap that sizes
+// its table according to p.
+func NewWithPolicy(p sizing.SizePolicy) *HashMap {
+//	fmt.Printf("NewWithPolicy\n")
+	return new(HashMap).InitWithPolicy(p)
+}
+
 func (self *HashMap) Insert(key Hashable, value interface{}) {
 //	fmt.Printf("Insert %s->%s\n", key, value)
-	if self.loadFactor() >= loadGrow {
+	self.watch.start()
+	p := self.buckets.find(key)
+	if self.buckets.data[p].state == used {
+		panic("HashMap.Insert: duplicate key")
+	}
+
+	switch {
+	case self.loadFactor() >= loadGrow:
 		self.grow()
+		p = self.buckets.find(key)
+	case self.dirtyFactor() >= loadDirty:
+		// same size, just drop the deleted buckets
+		self.resize(uint64(len(self.buckets.data)))
+		p = self.buckets.find(key)
 	}
 
-	if !self.buckets.push(key, value) {
-		panic("HashMap.Insert: duplicate key")
+	if self.buckets.data[p].state == deleted {
+		self.deleted--
 	}
+	self.buckets.data[p] = bucket{HashPair{key, value}, used}
 	self.count++
+	self.watch.inserted(key, value)
+	self.watch.end()
 }
 
 func (self *HashMap) Remove(key Hashable) {
 //	fmt.Printf("Remove %s\n", key)
-	if !self.buckets.pop(key) {
+	self.watch.start()
+	e, ok := self.buckets.pop(key)
+	if !ok {
 		panic("HashMap.Remove: key not found")
 	}
 	self.count--
+	self.deleted++
+	self.watch.removed(e.Key, e.Value)
 
-	if self.loadFactor() <= loadShrink {
+	if self.autoShrink && self.loadFactor() <= loadShrink {
 		self.shrink()
 	}
+	self.watch.end()
 }
 
 func (self *HashMap) At(key Hashable) interface{} {
@@ -144,7 +229,10 @@ func (self *HashMap) Set(key Hashable, value interface{}) {
 	if b.data[p].state != used {
 		panic("HashMap.Set: key not found")
 	}
+	self.watch.start()
+	self.watch.updated(b.data[p].pair.Key, b.data[p].pair.Value, value)
 	b.data[p].pair.Value = value
+	self.watch.end()
 }
 
 func (self *HashMap) Has(key Hashable) bool {
@@ -154,6 +242,45 @@ func (self *HashMap) Has(key Hashable) bool {
 	return b.data[p].state == used;
 }
 
+// Reserve grows the table so that n pairs fit without any
+// further rehashing, and keeps it from shrinking below that
+// until Reserve is called again. Reserve(0) lifts the floor.
+func (self *HashMap) Reserve(n int) {
+//	fmt.Printf("Reserve %d\n", n)
+	self.reserved = n
+	if s := self.tableSize(n); s > uint64(len(self.buckets.data)) {
+		self.watch.start()
+		self.resize(s)
+		self.grows++
+		self.watch.end()
+	}
+}
+
+// Compact rebuilds the table at the size it would have if
+// all pairs had been inserted into a fresh map, which also
+// clears out the deleted buckets.
+func (self *HashMap) Compact() {
+//	fmt.Printf("Compact\n")
+	s := self.idealSize()
+	l := uint64(len(self.buckets.data))
+	switch {
+	case s > l:
+		self.grows++
+	case s < l:
+		self.shrinks++
+	}
+	self.watch.start()
+	self.resize(s)
+	self.watch.end()
+}
+
+// SetAutoShrink controls whether Remove shrinks the table,
+// which it does by default. Without it the table only
+// shrinks on Compact.
+func (self *HashMap) SetAutoShrink(on bool) {
+	self.autoShrink = on
+}
+
 func (self *HashMap) Len() int {
 //	fmt.Printf("Len %d\n", self.count)
 	return self.count
@@ -169,6 +296,18 @@ func (self *HashMap) Do(f func(key Hashable, value interface{})) {
 	}
 }
 
+// Range calls f for every pair until f returns false.
+func (self *HashMap) Range(f func(key Hashable, value interface{}) bool) {
+//	fmt.Printf("Range %s\n", f)
+	for _, b := range self.buckets.data {
+		if b.state == used {
+			if !f(b.pair.Key, b.pair.Value) {
+				return
+			}
+		}
+	}
+}
+
 func (self *HashMap) iterate(c chan<- interface{}) {
 //	fmt.Printf("Iterate %s\n", c)
 	for _, b := range self.buckets.data {
@@ -185,3 +324,147 @@ func (self *HashMap) Iter() <-chan interface{} {
 	go self.iterate(c)
 	return c
 }
+
+// Keys returns all keys in bucket order.
+func (self *HashMap) Keys() []Hashable {
+//	fmt.Printf("Keys\n")
+	keys := make([]Hashable, self.count)
+	i := 0
+	for _, b := range self.buckets.data {
+		if b.state == used {
+			keys[i] = b.pair.Key
+			i++
+		}
+	}
+	return keys
+}
+
+// Values returns all values in bucket order.
+func (self *HashMap) Values() []interface{} {
+//	fmt.Printf("Values\n")
+	values := make([]interface{}, self.count)
+	i := 0
+	for _, b := range self.buckets.data {
+		if b.state == used {
+			values[i] = b.pair.Value
+			i++
+		}
+	}
+	return values
+}
+
+// Entries returns all pairs in bucket order.
+func (self *HashMap) Entries() []HashPair {
+//	fmt.Printf("Entries\n")
+	pairs := make([]HashPair, self.count)
+	i := 0
+	for _, b := range self.buckets.data {
+		if b.state == used {
+			pairs[i] = b.pair
+			i++
+		}
+	}
+	return pairs
+}
+
+// Filter returns a new map with the pairs for which pred
+// is true, sized for exactly those pairs.
+func (self *HashMap) Filter(pred func(key Hashable, value interface{}) bool) *HashMap {
+//	fmt.Printf("Filter %s\n", pred)
+	pairs := make([]HashPair, self.count)
+	n := 0
+	for _, b := range self.buckets.data {
+		if b.state == used && pred(b.pair.Key, b.pair.Value) {
+			pairs[n] = b.pair
+			n++
+		}
+	}
+
+	m := new(HashMap)
+	m.policy = self.policy
+	m.autoShrink = self.autoShrink
+	m.buckets.data = make([]bucket, self.tableSize(n))
+	for _, e := range pairs[0:n] {
+		m.buckets.push(e.Key, e.Value)
+	}
+	m.count = n
+	return m
+}
+
+// MapValues returns a new map with the same keys and the
+// values replaced by fn. It reuses the bucket layout so no
+// key is hashed again, and Stats() of the new map tell the
+// same story.
+func (self *HashMap) MapValues(fn func(key Hashable, value interface{}) interface{}) *HashMap {
+//	fmt.Printf("MapValues %s\n", fn)
+	m := new(HashMap)
+	m.buckets.data = make([]bucket, len(self.buckets.data))
+	copy(m.buckets.data, self.buckets.data)
+	for i := range m.buckets.data {
+		b := &m.buckets.data[i]
+		if b.state == used {
+			b.pair.Value = fn(b.pair.Key, b.pair.Value)
+		}
+	}
+	m.count = self.count
+	m.deleted = self.deleted
+	m.policy = self.policy
+	m.reserved = self.reserved
+	m.autoShrink = self.autoShrink
+	m.grows = self.grows
+	m.shrinks = self.shrinks
+	return m
+}
+
+// Reduce folds fn over all pairs in bucket order, starting
+// with initial, and returns the result.
+func (self *HashMap) Reduce(initial interface{}, fn func(acc interface{}, key Hashable, value interface{}) interface{}) interface{} {
+//	fmt.Printf("Reduce %s\n", fn)
+	acc := initial
+	for _, b := range self.buckets.data {
+		if b.state == used {
+			acc = fn(acc, b.pair.Key, b.pair.Value)
+		}
+	}
+	return acc
+}
+
+// Stats describes the table; Grows and Shrinks count the
+// rehashes since Init().
+func (self *HashMap) Stats() Stats {
+//	fmt.Printf("Stats\n")
+	var s Stats
+	d := self.buckets.data
+	l := uint(len(d))
+	s.Buckets = len(d)
+	s.Entries = self.count
+	s.LoadFactor = self.loadFactor()
+	s.Bytes = int(unsafe.Sizeof(*self)) + len(d)*int(unsafe.Sizeof(bucket{}))
+	for i, b := range d {
+		switch b.state {
+		case used:
+			h := b.pair.Key.Hash() % l
+			s.ProbeLengths = histogram(s.ProbeLengths, int((uint(i)+l-h)%l))
+		case deleted:
+			s.Tombstones++
+		}
+	}
+	s.Grows = self.grows
+	s.Shrinks = self.shrinks
+	return s
+}
+
+// Dump writes '#' for every used, 'x' for every deleted,
+// and '.' for every fresh bucket to w.
+func (self *HashMap) Dump(w io.Writer) {
+//	fmt.Printf("Dump\n")
+	dump(w, self.Stats(), func(i int) byte {
+		switch self.buckets.data[i].state {
+		case used:
+			return '#'
+		case deleted:
+			return 'x'
+		}
+		return '.'
+	})
+}
@@ -0,0 +1,262 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "container/hashmap/sizing"
+import "rand"
+import "testing"
+
+type Integer int
+
+func (self Integer) Hash() uint { return uint(self*self) }
+func (self Integer) Equal(other Hashable) bool { return self == other.(Integer) }
+
+// Grows eight times over at once, so that without
+// hysteresis the first Remove after a grow shrinks back.
+type octuple struct{}
+
+func (octuple) Initial() uint64 { return 8 }
+func (octuple) Grow(n uint64) uint64 {
+	if n >= 1<<60 {
+		return 0
+	}
+	return n * 8
+}
+func (octuple) Shrink(n uint64) uint64 {
+	if n <= 8 {
+		return n
+	}
+	return n / 8
+}
+
+func TestNoThrash(t *testing.T) {
+	const Rounds = 1000
+	for _, p := range []sizing.SizePolicy{sizing.PrimesNearPowers, octuple{}} {
+		a := NewWithPolicy(p)
+		i := 0
+		for ; a.Stats().Grows == 0; i++ {
+			a.Insert(Integer(i), i)
+		}
+		before := a.Stats()
+		for r := 0; r < Rounds; r++ {
+			a.Remove(Integer(i - 1))
+			a.Insert(Integer(i-1), i-1)
+		}
+		after := a.Stats()
+		if n := after.Grows + after.Shrinks - before.Grows - before.Shrinks; n != 0 {
+			t.Errorf("%T: expected no rehash at %d pairs, got %d", p, i, n)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	const Len = 1000
+	a := New()
+	a.Reserve(Len)
+	s := a.Stats()
+	if uint64(s.Buckets) != a.tableSize(Len) || s.Grows != 1 {
+		t.Errorf("expected %d buckets after 1 grow, got %d after %d", a.tableSize(Len), s.Buckets, s.Grows)
+	}
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	for i := 0; i < Len; i++ {
+		a.Remove(Integer(i))
+	}
+	if s = a.Stats(); uint64(s.Buckets) != a.tableSize(Len) || s.Grows != 1 || s.Shrinks != 0 {
+		t.Errorf("expected %d buckets without rehash, got %d after %d grows and %d shrinks", a.tableSize(Len), s.Buckets, s.Grows, s.Shrinks)
+	}
+	a.Compact()
+	if s = a.Stats(); uint64(s.Buckets) != a.tableSize(Len) || s.Tombstones != 0 {
+		t.Errorf("expected Compact to keep %d buckets and drop tombstones, got %d and %d", a.tableSize(Len), s.Buckets, s.Tombstones)
+	}
+	a.Reserve(0)
+	a.Compact()
+	if uint64(len(a.buckets.data)) != a.tableSize(0) {
+		t.Errorf("expected Compact to shrink to %d buckets, got %d", a.tableSize(0), len(a.buckets.data))
+	}
+}
+
+func TestAutoShrink(t *testing.T) {
+	const Len = 1000
+	a := New()
+	a.SetAutoShrink(false)
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	size := len(a.buckets.data)
+	for i := 0; i < Len; i++ {
+		if i%10 != 0 {
+			a.Remove(Integer(i))
+		}
+	}
+	if s := a.Stats(); s.Buckets != size || s.Shrinks != 0 {
+		t.Errorf("expected %d buckets without shrinking, got %d after %d shrinks", size, s.Buckets, s.Shrinks)
+	}
+	a.Compact()
+	if s := a.Stats(); uint64(s.Buckets) != a.tableSize(2*Len/10) || s.Tombstones != 0 {
+		t.Errorf("expected Compact to shrink to %d buckets without tombstones, got %d and %d", a.tableSize(2*Len/10), s.Buckets, s.Tombstones)
+	}
+	for i := 0; i < Len; i += 10 {
+		if a.At(Integer(i)).(int) != i {
+			t.Errorf("%d lost in Compact", i)
+		}
+	}
+}
+
+// The mean number of probes a lookup that misses takes, if
+// its hash is as likely to pick any bucket: up to and
+// including the next fresh bucket.
+func meanProbes(d []bucket) float {
+	sum, run := 0, 0
+	for i := 2*len(d) - 1; i >= 0; i-- {
+		if d[i%len(d)].state == fresh {
+			run = 0
+		} else {
+			run++
+		}
+		if i < len(d) {
+			sum += run + 1
+		}
+	}
+	return float(sum) / float(len(d))
+}
+
+// Like test_random.go, but checked against a builtin map, and
+// with removals mixed in so deleted buckets pile up.
+func TestRandomStress(t *testing.T) {
+	const N = 200000
+	const S = 2000
+	rand.Seed(1)
+	a := New()
+	shadow := make(map[Integer]int)
+	for i := 0; i < N; i++ {
+		k := Integer(rand.Intn(S))
+		if _, ok := shadow[k]; ok {
+			a.Remove(k)
+			shadow[k] = 0, false
+		} else {
+			a.Insert(k, i)
+			shadow[k] = i
+		}
+		// Insert cleans up before it pushes, so at most the
+		// bucket it filled is past the threshold
+		if float(a.count+a.deleted-1) >= loadDirty*float(len(a.buckets.data)) {
+			t.Fatalf("%d used and %d deleted of %d buckets", a.count, a.deleted, len(a.buckets.data))
+		}
+		// with linear probing a lookup that misses takes
+		// (1 + 1/(1-f)^2)/2 probes on average when used and
+		// deleted buckets fill f of the table (Knuth, TAOCP
+		// 6.4), 8.5 at loadDirty; allow a quarter more for
+		// the spread of a few thousand keys
+		if i%100 == 0 {
+			f := float(a.count+a.deleted) / float(len(a.buckets.data))
+			expected := (1 + 1/((1-f)*(1-f))) / 2
+			if m := meanProbes(a.buckets.data); m > 1.25*expected {
+				t.Fatalf("%.2f probes per miss at %.2f full, expected %.2f", m, f, expected)
+			}
+		}
+	}
+	if a.Len() != len(shadow) {
+		t.Errorf("expected %d, got %d", len(shadow), a.Len())
+	}
+	for k, v := range shadow {
+		if a.At(k).(int) != v {
+			t.Errorf("expected %d at %d, got %d", v, k, a.At(k))
+		}
+	}
+	if s := a.Stats(); s.Tombstones != a.deleted {
+		t.Errorf("counted %d deleted buckets, Stats found %d", a.deleted, s.Tombstones)
+	}
+}
+
+func TestMapValuesStats(t *testing.T) {
+	const Len = 1000
+	a := New()
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	for i := 0; i < Len-10; i++ {
+		a.Remove(Integer(i))
+	}
+	a.SetAutoShrink(false)
+	a.Reserve(100)
+	for i := 0; i < 10; i++ {
+		a.Remove(Integer(Len - 1 - i))
+	}
+	m := a.MapValues(func(key Hashable, value interface{}) interface{} { return -value.(int) })
+	before, after := a.Stats(), m.Stats()
+	if before.Grows == 0 || before.Shrinks == 0 || after.Grows != before.Grows || after.Shrinks != before.Shrinks ||
+		after.Buckets != before.Buckets || after.Tombstones != before.Tombstones {
+		t.Errorf("expected %v from MapValues, got %v", before, after)
+	}
+	if m.autoShrink || m.reserved != 100 {
+		t.Errorf("expected MapValues to keep auto shrinking off and 100 reserved")
+	}
+}
+
+// Rehashing in place to drop deleted buckets isn't a resize
+// observers hear about, the table keeps its size.
+func TestObserveTombstones(t *testing.T) {
+	const Len = 1000
+	a := New()
+	a.SetAutoShrink(false)
+	for i := 0; i < Len; i++ {
+		a.Insert(Int(i), i)
+	}
+	m := newMirror(t, a)
+	a.Observe(m.observer())
+	size := a.Stats().Buckets
+	cleaned := false
+	for i := 0; i < Len; i++ {
+		a.Remove(Int(i))
+		d := a.Stats().Tombstones
+		a.Insert(Int(Len+i), i)
+		if d > 1 && a.Stats().Tombstones == 0 {
+			cleaned = true
+		}
+	}
+	if !cleaned {
+		t.Fatalf("expected a rehash in place")
+	}
+	if b := a.Stats().Buckets; b != size || m.resizes != 0 {
+		t.Errorf("expected %d buckets and no resizes, got %d and %d", size, b, m.resizes)
+	}
+	if m.changes != 2*Len {
+		t.Errorf("expected %d changes, got %d", 2*Len, m.changes)
+	}
+	m.check("after rehash in place", a)
+}
+
+// Lookups move pairs into deleted buckets earlier in their
+// probe run; observers hear nothing of it, Set aside.
+func TestObserveRelocate(t *testing.T) {
+	const Run = 8
+	a := New()
+	a.Reserve(4 * Run)
+	size := a.Stats().Buckets
+	for i := 0; i < Run; i++ {
+		a.Insert(Int(i*size), i) // all probe from bucket 0
+	}
+	a.Remove(Int(0))
+	m := newMirror(t, a)
+	a.Observe(m.observer())
+	last := Int((Run - 1) * size)
+	if !a.Has(last) {
+		t.Fatalf("%d lost", last)
+	}
+	if a.buckets.data[0].state != used || a.buckets.data[0].pair.Key != Hashable(last) {
+		t.Fatalf("expected Has to move %d into bucket 0", last)
+	}
+	a.Remove(Int(size))
+	a.Set(last-Int(size), -1) // moves into bucket 1
+	if a.buckets.data[1].pair.Key != Hashable(last-Int(size)) {
+		t.Fatalf("expected Set to move %d into bucket 1", last-Int(size))
+	}
+	if m.changes != 2 || m.resizes != 0 {
+		t.Errorf("expected 2 changes and no resizes, got %d and %d", m.changes, m.resizes)
+	}
+	m.check("after moves", a)
+}
@@ -0,0 +1,446 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+//import "fmt"
+import "unsafe"
+
+// A hash array mapped trie: every level of nodes picks one
+// of 32 children with the next 5 bits of the hash, and only
+// stores the children that are there, compacted by a bitmap.
+// Changing a pair copies the nodes on its path and shares all
+// others with the old map. Keys whose hashes are equal in all
+// bits end up together in a collision node.
+
+const hamtBits = 5
+const hamtMask = 1<<hamtBits - 1
+
+// Bits in a uint, 32 or 64.
+const hashBits = 32 << (^uint(0) >> 63)
+
+type hamtEntry struct {
+	hash	uint
+	pair	HashPair // unless node is set
+	node	*hamtNode
+}
+
+type hamtNode struct {
+	bitmap	uint32 // which of the 32 children exist
+	entries	[]hamtEntry // in order of their bits
+	pairs	[]HashPair // instead, for a collision node
+	hash	uint // of all pairs in a collision node
+	owner	*owner // the Transient that may change it
+}
+
+// Transients own the nodes they made and change those in
+// place. Tokens must have a size, pointers to zero-size
+// values can all be the same.
+type owner struct {
+	done bool
+}
+
+// PersistentMap is an immutable map: Insert, Set and Remove
+// return a new map and leave the old one as it was, sharing
+// all nodes they didn't have to change. Operations take
+// O(log32 n). The zero value is an empty map.
+type PersistentMap struct {
+	root	*hamtNode
+	count	int
+}
+
+// NewPersistent returns an empty PersistentMap.
+func NewPersistent() *PersistentMap {
+//	fmt.Printf("NewPersistent\n")
+	return new(PersistentMap)
+}
+
+func popcount(x uint32) int {
+	x = x - (x>>1)&0x55555555
+	x = x&0x33333333 + (x>>2)&0x33333333
+	x = (x + x>>4) & 0x0f0f0f0f
+	return int(x * 0x01010101 >> 24)
+}
+
+// Which bit of the bitmap hash selects at shift, and the
+// index its entry has if there is one.
+func (self *hamtNode) slot(hash uint, shift uint) (bit uint32, index int) {
+	bit = 1 << ((hash >> shift) & hamtMask)
+	return bit, popcount(self.bitmap & (bit - 1))
+}
+
+// A copy of self that o may change, or self if o owns it.
+func (self *hamtNode) editable(o *owner) *hamtNode {
+	if o != nil && self.owner == o {
+		return self
+	}
+	c := &hamtNode{bitmap: self.bitmap, hash: self.hash, owner: o}
+	if self.pairs != nil {
+		c.pairs = make([]HashPair, len(self.pairs))
+		copy(c.pairs, self.pairs)
+	} else {
+		c.entries = make([]hamtEntry, len(self.entries))
+		copy(c.entries, self.entries)
+	}
+	return c
+}
+
+// Make room for an entry at index i.
+func (self *hamtNode) insertEntry(i int, e hamtEntry) {
+	d := make([]hamtEntry, len(self.entries)+1)
+	copy(d, self.entries[0:i])
+	d[i] = e
+	copy(d[i+1:], self.entries[i:])
+	self.entries = d
+}
+
+func (self *hamtNode) removeEntry(i int) {
+	d := make([]hamtEntry, len(self.entries)-1)
+	copy(d, self.entries[0:i])
+	copy(d[i:], self.entries[i+1:])
+	self.entries = d
+}
+
+// The only pair left in a node, if that's all there is, so
+// the parent can hold it itself.
+func (self *hamtNode) single() (e hamtEntry, ok bool) {
+	switch {
+	case self.pairs != nil && len(self.pairs) == 1:
+		return hamtEntry{self.hash, self.pairs[0], nil}, true
+	case self.pairs == nil && len(self.entries) == 1 && self.entries[0].node == nil:
+		return self.entries[0], true
+	}
+	return hamtEntry{}, false
+}
+
+func (self *hamtNode) get(hash uint, key Hashable) *HashPair {
+	n := self
+	for shift := uint(0); n != nil; shift += hamtBits {
+		if n.pairs != nil {
+			for i := range n.pairs {
+				if keysEqual(key, n.pairs[i].Key) {
+					return &n.pairs[i]
+				}
+			}
+			return nil
+		}
+		bit, i := n.slot(hash, shift)
+		if n.bitmap&bit == 0 {
+			return nil
+		}
+		e := &n.entries[i]
+		if e.node == nil {
+			if e.hash == hash && keysEqual(key, e.pair.Key) {
+				return &e.pair
+			}
+			return nil
+		}
+		n = e.node
+	}
+	return nil
+}
+
+// A node holding two pairs from shift on.
+func hamtPair(shift uint, a hamtEntry, b hamtEntry, o *owner) *hamtNode {
+	if shift >= hashBits {
+		return &hamtNode{pairs: []HashPair{a.pair, b.pair}, hash: a.hash, owner: o}
+	}
+	n := &hamtNode{owner: o}
+	ba, _ := n.slot(a.hash, shift)
+	bb, _ := n.slot(b.hash, shift)
+	switch {
+	case ba == bb:
+		n.bitmap = ba
+		n.entries = []hamtEntry{hamtEntry{a.hash, HashPair{}, hamtPair(shift+hamtBits, a, b, o)}}
+	case ba < bb:
+		n.bitmap = ba | bb
+		n.entries = []hamtEntry{a, b}
+	default:
+		n.bitmap = ba | bb
+		n.entries = []hamtEntry{b, a}
+	}
+	return n
+}
+
+// Put e into the trie below n, replacing the value if its
+// key is there already; returns the changed node.
+func (self *hamtNode) assoc(shift uint, e hamtEntry, o *owner) *hamtNode {
+	n := self.editable(o)
+	if n.pairs != nil {
+		for i := range n.pairs {
+			if keysEqual(e.pair.Key, n.pairs[i].Key) {
+				n.pairs[i].Value = e.pair.Value
+				return n
+			}
+		}
+		d := make([]HashPair, len(n.pairs)+1)
+		copy(d, n.pairs)
+		d[len(n.pairs)] = e.pair
+		n.pairs = d
+		return n
+	}
+
+	bit, i := n.slot(e.hash, shift)
+	if n.bitmap&bit == 0 {
+		n.bitmap |= bit
+		n.insertEntry(i, e)
+		return n
+	}
+	old := &n.entries[i]
+	switch {
+	case old.node != nil:
+		old.node = old.node.assoc(shift+hamtBits, e, o)
+	case old.hash == e.hash && keysEqual(e.pair.Key, old.pair.Key):
+		old.pair.Value = e.pair.Value
+	default:
+		*old = hamtEntry{old.hash, HashPair{}, hamtPair(shift+hamtBits, *old, e, o)}
+	}
+	return n
+}
+
+// Drop key, which has to be there, from the trie below n;
+// returns the changed node or nil if it's empty now.
+func (self *hamtNode) without(shift uint, hash uint, key Hashable, o *owner) *hamtNode {
+	n := self.editable(o)
+	if n.pairs != nil {
+		d := make([]HashPair, len(n.pairs)-1)
+		j := 0
+		for _, p := range n.pairs {
+			if !keysEqual(key, p.Key) {
+				d[j] = p
+				j++
+			}
+		}
+		n.pairs = d
+		return n
+	}
+
+	bit, i := n.slot(hash, shift)
+	e := &n.entries[i]
+	if e.node != nil {
+		// below the root, nodes hold two pairs at least,
+		// so the child isn't empty
+		child := e.node.without(shift+hamtBits, hash, key, o)
+		if s, ok := child.single(); ok {
+			*e = s
+		} else {
+			e.node = child
+		}
+		return n
+	}
+	n.bitmap &^= bit
+	n.removeEntry(i)
+	if len(n.entries) == 0 {
+		return nil
+	}
+	return n
+}
+
+func (self *hamtNode) do(f func(key Hashable, value interface{}) bool) bool {
+	for _, p := range self.pairs {
+		if !f(p.Key, p.Value) {
+			return false
+		}
+	}
+	for _, e := range self.entries {
+		if e.node != nil {
+			if !e.node.do(f) {
+				return false
+			}
+		} else if !f(e.pair.Key, e.pair.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Count the node and those below it into s; pairs in it are
+// depth nodes below the root.
+func (self *hamtNode) stats(s *Stats, depth int) {
+	s.Buckets++
+	s.Bytes += int(unsafe.Sizeof(*self)) + cap(self.entries)*int(unsafe.Sizeof(hamtEntry{})) +
+		cap(self.pairs)*int(unsafe.Sizeof(HashPair{}))
+	for _ = range self.pairs {
+		s.ProbeLengths = histogram(s.ProbeLengths, depth)
+	}
+	for _, e := range self.entries {
+		if e.node != nil {
+			e.node.stats(s, depth+1)
+		} else {
+			s.ProbeLengths = histogram(s.ProbeLengths, depth)
+		}
+	}
+}
+
+func hamtFind(root *hamtNode, key Hashable) *HashPair {
+	if root == nil {
+		return nil
+	}
+	return root.get(key.Hash(), key)
+}
+
+func hamtPut(root *hamtNode, key Hashable, value interface{}, o *owner) *hamtNode {
+	e := hamtEntry{key.Hash(), HashPair{key, value}, nil}
+	if root == nil {
+		root = &hamtNode{owner: o}
+	}
+	return root.assoc(0, e, o)
+}
+
+// Insert returns a map that also maps key to value.
+func (self *PersistentMap) Insert(key Hashable, value interface{}) *PersistentMap {
+//	fmt.Printf("Insert %s->%s\n", key, value)
+	if self.Has(key) {
+		panic("PersistentMap.Insert: duplicate key")
+	}
+	return &PersistentMap{hamtPut(self.root, key, value, nil), self.count + 1}
+}
+
+// Remove returns a map without key.
+func (self *PersistentMap) Remove(key Hashable) *PersistentMap {
+//	fmt.Printf("Remove %s\n", key)
+	if !self.Has(key) {
+		panic("PersistentMap.Remove: key not found")
+	}
+	return &PersistentMap{self.root.without(0, key.Hash(), key, nil), self.count - 1}
+}
+
+// Set returns a map that maps key to value instead.
+func (self *PersistentMap) Set(key Hashable, value interface{}) *PersistentMap {
+//	fmt.Printf("Set %s->%s\n", key, value)
+	if !self.Has(key) {
+		panic("PersistentMap.Set: key not found")
+	}
+	return &PersistentMap{hamtPut(self.root, key, value, nil), self.count}
+}
+
+func (self *PersistentMap) At(key Hashable) interface{} {
+//	fmt.Printf("At %s\n", key)
+	p := hamtFind(self.root, key)
+	if p == nil {
+		panic("PersistentMap.At: key not found")
+	}
+	return p.Value
+}
+
+func (self *PersistentMap) Has(key Hashable) bool {
+//	fmt.Printf("Has %s\n", key)
+	return hamtFind(self.root, key) != nil
+}
+
+func (self *PersistentMap) Len() int {
+//	fmt.Printf("Len %d\n", self.count)
+	return self.count
+}
+
+// Stats counts the nodes of the trie as buckets, and the
+// pairs n nodes below the root, which a lookup visits n more
+// nodes for, in ProbeLengths[n]. Nothing is ever rehashed
+// and a node has no load to speak of, so LoadFactor, Grows
+// and Shrinks stay zero. Stats takes O(n).
+func (self *PersistentMap) Stats() Stats {
+//	fmt.Printf("Stats\n")
+	var s Stats
+	s.Entries = self.count
+	s.Bytes = int(unsafe.Sizeof(*self))
+	if self.root != nil {
+		self.root.stats(&s, 0)
+	}
+	return s
+}
+
+func (self *PersistentMap) Do(f func(key Hashable, value interface{})) {
+//	fmt.Printf("Do %s\n", f)
+	self.Range(func(key Hashable, value interface{}) bool {
+		f(key, value)
+		return true
+	})
+}
+
+// Range calls f for every pair until f returns false.
+func (self *PersistentMap) Range(f func(key Hashable, value interface{}) bool) {
+//	fmt.Printf("Range %s\n", f)
+	if self.root != nil {
+		self.root.do(f)
+	}
+}
+
+// Transient is a mutable builder for a PersistentMap. It
+// changes the nodes it made itself in place instead of
+// copying them again for every pair, which makes batches
+// much faster. The map it started from doesn't change.
+type Transient struct {
+	root	*hamtNode
+	count	int
+	owner	*owner
+}
+
+// Transient returns a builder starting out with the pairs
+// of the map.
+func (self *PersistentMap) Transient() *Transient {
+//	fmt.Printf("Transient\n")
+	return &Transient{self.root, self.count, new(owner)}
+}
+
+func (self *Transient) check() {
+	if self.owner.done {
+		panic("Transient: used after Persistent")
+	}
+}
+
+// Persistent returns the map built so far. The Transient
+// can't be used anymore after that.
+func (self *Transient) Persistent() *PersistentMap {
+//	fmt.Printf("Persistent\n")
+	self.check()
+	self.owner.done = true
+	return &PersistentMap{self.root, self.count}
+}
+
+func (self *Transient) Insert(key Hashable, value interface{}) {
+//	fmt.Printf("Insert %s->%s\n", key, value)
+	if self.Has(key) {
+		panic("Transient.Insert: duplicate key")
+	}
+	self.root = hamtPut(self.root, key, value, self.owner)
+	self.count++
+}
+
+func (self *Transient) Remove(key Hashable) {
+//	fmt.Printf("Remove %s\n", key)
+	if !self.Has(key) {
+		panic("Transient.Remove: key not found")
+	}
+	self.root = self.root.without(0, key.Hash(), key, self.owner)
+	self.count--
+}
+
+func (self *Transient) Set(key Hashable, value interface{}) {
+//	fmt.Printf("Set %s->%s\n", key, value)
+	if !self.Has(key) {
+		panic("Transient.Set: key not found")
+	}
+	self.root = hamtPut(self.root, key, value, self.owner)
+}
+
+func (self *Transient) At(key Hashable) interface{} {
+//	fmt.Printf("At %s\n", key)
+	self.check()
+	p := hamtFind(self.root, key)
+	if p == nil {
+		panic("Transient.At: key not found")
+	}
+	return p.Value
+}
+
+func (self *Transient) Has(key Hashable) bool {
+//	fmt.Printf("Has %s\n", key)
+	self.check()
+	return hamtFind(self.root, key) != nil
+}
+
+func (self *Transient) Len() int {
+//	fmt.Printf("Len %d\n", self.count)
+	return self.count
+}
@@ -0,0 +1,192 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "testing"
+
+func TestPersistentVersions(t *testing.T) {
+	const Len = 1000
+	versions := make([]*PersistentMap, Len+1)
+	versions[0] = NewPersistent()
+	for i := 0; i < Len; i++ {
+		versions[i+1] = versions[i].Insert(Integer(i), i)
+	}
+	// every version still has exactly its own pairs
+	for v := 0; v <= Len; v += 100 {
+		m := versions[v]
+		if m.Len() != v {
+			t.Errorf("version %d has %d pairs", v, m.Len())
+		}
+		for i := 0; i < Len; i++ {
+			if m.Has(Integer(i)) != (i < v) {
+				t.Errorf("version %d: Has(%d) is wrong", v, i)
+			}
+		}
+	}
+
+	m := versions[Len]
+	for i := 0; i < Len; i += 2 {
+		m = m.Remove(Integer(i))
+	}
+	for i := 1; i < Len; i += 2 {
+		m = m.Set(Integer(i), -i)
+	}
+	for i := 0; i < Len; i++ {
+		if m.Has(Integer(i)) != (i%2 == 1) || versions[Len].At(Integer(i)).(int) != i {
+			t.Errorf("%d: Remove or Set changed the old version", i)
+		}
+		if i%2 == 1 && m.At(Integer(i)).(int) != -i {
+			t.Errorf("%d: Set didn't", i)
+		}
+	}
+	n := 0
+	m.Do(func(key Hashable, value interface{}) {
+		if value.(int) != -int(key.(Integer)) {
+			t.Errorf("Do got %d->%d", key, value)
+		}
+		n++
+	})
+	if n != m.Len() {
+		t.Errorf("Do visited %d of %d", n, m.Len())
+	}
+	for i := 1; i < Len; i += 2 {
+		m = m.Remove(Integer(i))
+	}
+	if m.Len() != 0 || m.root != nil {
+		t.Errorf("expected an empty map, got %d pairs", m.Len())
+	}
+}
+
+func TestPersistentSharing(t *testing.T) {
+	const Len = 10000
+	m := NewPersistent()
+	for i := 0; i < Len; i++ {
+		m = m.Insert(Integer(i), i)
+	}
+	n := m.Set(Integer(1), -1)
+	// only the path to Integer(1) is new
+	shared := 0
+	for i, e := range n.root.entries {
+		if e.node != nil && e.node == m.root.entries[i].node {
+			shared++
+		}
+	}
+	if shared != len(m.root.entries)-1 {
+		t.Errorf("expected %d children shared, got %d", len(m.root.entries)-1, shared)
+	}
+}
+
+func TestPersistentCollisions(t *testing.T) {
+	// collider only has 7 hashes, so collision nodes
+	const Len = 1000
+	m := NewPersistent()
+	for i := 0; i < Len; i++ {
+		m = m.Insert(collider(i), i)
+	}
+	for i := 0; i < Len; i += 3 {
+		m = m.Remove(collider(i))
+	}
+	for i := 0; i < Len; i++ {
+		if m.Has(collider(i)) != (i%3 != 0) {
+			t.Errorf("Has(%d) is wrong", i)
+		}
+	}
+	if m.Len() != Len-(Len+2)/3 {
+		t.Errorf("expected %d, got %d", Len-(Len+2)/3, m.Len())
+	}
+}
+
+func TestPersistentStats(t *testing.T) {
+	const Len = 1000
+	if s := NewPersistent().Stats(); s.Buckets != 0 || s.Entries != 0 || s.ProbeLengths != nil {
+		t.Errorf("expected an empty map to have no nodes, got %v", s)
+	}
+	for _, collide := range []bool{false, true} {
+		m := NewPersistent()
+		for i := 0; i < Len; i++ {
+			if collide {
+				m = m.Insert(collider(i), i)
+			} else {
+				m = m.Insert(Integer(i), i)
+			}
+		}
+		s := m.Stats()
+		pairs := 0
+		for _, c := range s.ProbeLengths {
+			pairs += c
+		}
+		if s.Entries != Len || pairs != Len || s.Buckets < 2 || len(s.ProbeLengths) < 2 || s.Bytes <= 0 {
+			t.Errorf("%v: Stats don't add up: %v", collide, s)
+		}
+	}
+}
+
+func TestTransient(t *testing.T) {
+	const Len = 1000
+	base := NewPersistent().Insert(Integer(-1), -1)
+	b := base.Transient()
+	for i := 0; i < Len; i++ {
+		b.Insert(Integer(i), i)
+	}
+	for i := 0; i < Len; i += 2 {
+		b.Remove(Integer(i))
+	}
+	b.Set(Integer(-1), 1)
+	m := b.Persistent()
+	if base.Len() != 1 || base.At(Integer(-1)).(int) != -1 {
+		t.Errorf("Transient changed the map it started from")
+	}
+	if m.Len() != Len/2+1 || m.At(Integer(-1)).(int) != 1 {
+		t.Errorf("expected %d pairs, got %d", Len/2+1, m.Len())
+	}
+	for i := 0; i < Len; i++ {
+		if m.Has(Integer(i)) != (i%2 == 1) {
+			t.Errorf("Has(%d) is wrong", i)
+		}
+	}
+
+	// a second batch mustn't change the first result
+	c := m.Transient()
+	c.Remove(Integer(1))
+	c.Insert(Integer(0), 0)
+	if !m.Has(Integer(1)) || m.Has(Integer(0)) {
+		t.Errorf("second Transient changed the first result")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic using a Transient after Persistent")
+		}
+	}()
+	b.Insert(Integer(Len), Len)
+}
+
+func BenchmarkPersistentInsert(b *testing.B) {
+	m := NewPersistent()
+	for i := 0; i < b.N; i++ {
+		m = m.Insert(Integer(i), i)
+	}
+}
+
+func BenchmarkTransientInsert(b *testing.B) {
+	m := NewPersistent().Transient()
+	for i := 0; i < b.N; i++ {
+		m.Insert(Integer(i), i)
+	}
+	m.Persistent()
+}
+
+func BenchmarkPersistentAt(b *testing.B) {
+	b.StopTimer()
+	t := NewPersistent().Transient()
+	for i := 0; i < 100000; i++ {
+		t.Insert(Integer(i), i)
+	}
+	m := t.Persistent()
+	b.StartTimer()
+	for i := 0; i < b.N; i++ {
+		m.At(Integer(i % 100000))
+	}
+}
@@ -0,0 +1,195 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The hashmap package re-implements Go's builtin map type.
+package hashmap
+
+import "io"
+import "unsafe"
+
+// Hashable is an interface that keys have to implement.
+type Hashable interface {
+	Hash() uint
+	Equal(other Hashable) bool
+}
+
+// HashMap is the container itself.
+// You must call Init() before using it.
+type HashMap struct {
+	m     map[uint]int // chain heads, see slab.go
+	nodes slab
+	count int
+}
+
+// HashPair is a key and a value.
+// Iter() yields HashPairs.
+type HashPair struct {
+	Key   Hashable
+	Value interface{}
+}
+
+// Init initializes or clears a HashMap.
+func (h *HashMap) Init() {
+	h.m = make(map[uint]int)
+	h.nodes = slab{}
+	h.count = 0
+}
+
+// New returns an initialized hashmap.
+func New() *HashMap {
+	var h HashMap
+	h.Init()
+	return &h
+}
+
+func (h *HashMap) find(key Hashable, insert bool) (fb *slabNode, found bool) {
+	hash := key.Hash()
+	b, ok := h.m[hash]
+	if ok {
+		for i := b; i != 0; i = h.nodes.at(i).next {
+			if p := h.nodes.at(i); keysEqual(p.pair.Key, key) {
+				return p, true
+			}
+		}
+	}
+	if insert {
+		i := h.nodes.alloc(HashPair{key, nil}, b)
+		h.m[hash] = i
+		h.count++
+		fb = h.nodes.at(i)
+	}
+	return
+}
+
+func (h *HashMap) Remove(key Hashable) {
+	var prev, p int
+
+	hash := key.Hash()
+	b := h.m[hash]
+	for p = b; p != 0; prev, p = p, h.nodes.at(p).next {
+		if keysEqual(h.nodes.at(p).pair.Key, key) {
+			break
+		}
+	}
+	switch {
+	case p == 0:
+		panic("HashMap.Remove: key not found")
+
+	case prev == 0:
+		if next := h.nodes.at(p).next; next == 0 {
+			h.m[hash] = 0, false
+		} else {
+			h.m[hash] = next
+		}
+
+	default:
+		h.nodes.at(prev).next = h.nodes.at(p).next
+	}
+	h.nodes.release(p)
+	h.count--
+}
+
+func (h *HashMap) At(key Hashable) (value interface{}) {
+	if b, _ := h.find(key, false); b != nil {
+		value = b.pair.Value
+	}
+	return
+}
+
+func (h *HashMap) Insert(key Hashable, value interface{}) {
+	b, found := h.find(key, true)
+	if found {
+		panic("HashMap.Insert: duplicate key")
+	}
+	b.pair.Value = value
+}
+
+func (h *HashMap) Set(key Hashable, value interface{}) {
+	b, _ := h.find(key, false)
+	if b == nil {
+		panic("HashMap.Set: key not found")
+	}
+	b.pair.Value = value
+}
+
+func (h *HashMap) Has(key Hashable) (found bool) {
+	_, found = h.find(key, false)
+	return
+}
+
+func (h *HashMap) Len() int { return h.count }
+
+func (h *HashMap) Do(f func(key Hashable, value interface{})) {
+	for _, b := range h.m {
+		for ; b != 0; b = h.nodes.at(b).next {
+			p := h.nodes.at(b).pair
+			f(p.Key, p.Value)
+		}
+	}
+}
+
+// Range calls f for every pair until f returns false.
+func (h *HashMap) Range(f func(key Hashable, value interface{}) bool) {
+	for _, b := range h.m {
+		for ; b != 0; b = h.nodes.at(b).next {
+			p := h.nodes.at(b).pair
+			if !f(p.Key, p.Value) {
+				return
+			}
+		}
+	}
+}
+
+func (h *HashMap) iterate(c chan<- interface{}) {
+	for _, b := range h.m {
+		for ; b != 0; b = h.nodes.at(b).next {
+			c <- h.nodes.at(b).pair
+		}
+	}
+	close(c)
+}
+
+func (h *HashMap) Iter() <-chan interface{} {
+	c := make(chan interface{})
+	go h.iterate(c)
+	return c
+}
+
+// Stats treats every distinct hash as a bucket. The builtin
+// map resizes itself, so Grows and Shrinks are always zero
+// and Bytes only guesses at its overhead.
+func (h *HashMap) Stats() (s Stats) {
+	s.Buckets = len(h.m)
+	s.Entries = h.count
+	if s.Buckets > 0 {
+		s.LoadFactor = float(s.Entries) / float(s.Buckets)
+	}
+	s.Bytes = int(unsafe.Sizeof(*h)) + 2*len(h.m)*int(unsafe.Sizeof(uint(0))+unsafe.Sizeof(int(0))) +
+		h.nodes.size()*int(unsafe.Sizeof(slabNode{}))
+	for _, b := range h.m {
+		n := 0
+		for ; b != 0; b = h.nodes.at(b).next {
+			n++
+		}
+		s.ChainLengths = histogram(s.ChainLengths, n)
+	}
+	return
+}
+
+// Dump writes the length of every chain to w, in the
+// builtin map's iteration order.
+func (h *HashMap) Dump(w io.Writer) {
+	s := h.Stats()
+	cells := make([]byte, s.Buckets)
+	i := 0
+	for _, b := range h.m {
+		n := 0
+		for ; b != 0; b = h.nodes.at(b).next {
+			n++
+		}
+		cells[i] = chainCell(n)
+		i++
+	}
+	dump(w, s, func(i int) byte { return cells[i] })
+}
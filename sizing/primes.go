@@ -0,0 +1,100 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sizing
+
+// Deterministic Miller-Rabin: these bases are enough to
+// decide primality for every n < 2**64.
+var witnesses = []uint64{2, 3, 5, 7, 11, 13, 17, 19, 23, 29, 31, 37}
+
+// (a + b) % m without overflow, for a, b < m.
+func addMod(a, b, m uint64) uint64 {
+	if a >= m-b {
+		return a - (m - b)
+	}
+	return a + b
+}
+
+// (a * b) % m without overflow, by doubling and adding.
+func mulMod(a, b, m uint64) uint64 {
+	a %= m
+	r := uint64(0)
+	for ; b > 0; b >>= 1 {
+		if b&1 == 1 {
+			r = addMod(r, a, m)
+		}
+		a = addMod(a, a, m)
+	}
+	return r
+}
+
+// (a ** e) % m
+func powMod(a, e, m uint64) uint64 {
+	r := uint64(1) % m
+	a %= m
+	for ; e > 0; e >>= 1 {
+		if e&1 == 1 {
+			r = mulMod(r, a, m)
+		}
+		a = mulMod(a, a, m)
+	}
+	return r
+}
+
+// IsPrime reports whether n is prime; it is exact for all
+// 64-bit n.
+func IsPrime(n uint64) bool {
+	if n < 2 {
+		return false
+	}
+	for _, p := range witnesses {
+		if n%p == 0 {
+			return n == p
+		}
+	}
+
+	// n-1 = d * 2**s with d odd
+	d := n - 1
+	s := 0
+	for d&1 == 0 {
+		d >>= 1
+		s++
+	}
+
+	for _, a := range witnesses {
+		x := powMod(a, d, n)
+		if x == 1 || x == n-1 {
+			continue
+		}
+		composite := true
+		for i := 1; i < s; i++ {
+			x = mulMod(x, x, n)
+			if x == n-1 {
+				composite = false
+				break
+			}
+		}
+		if composite {
+			return false
+		}
+	}
+	return true
+}
+
+// NextPrime returns the smallest prime >= n, or 0 if there
+// is none below 2**64.
+func NextPrime(n uint64) uint64 {
+	if n <= 2 {
+		return 2
+	}
+	if n&1 == 0 {
+		n++
+	}
+	for ; n != 1; n += 2 { // stop when wrapping around
+		if IsPrime(n) {
+			return n
+		}
+	}
+	return 0
+}
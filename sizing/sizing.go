@@ -0,0 +1,93 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// The sizing package decides how many buckets the tables
+// of container/hashmap have, and which size they grow and
+// shrink to.
+package sizing
+
+// SizePolicy is a ladder of table sizes.
+type SizePolicy interface {
+	// Initial returns the size a new table starts out with;
+	// tables never shrink below it.
+	Initial() uint64
+	// Grow returns the next size above n, or 0 if there is
+	// no bigger one.
+	Grow(n uint64) uint64
+	// Shrink returns the next size below n, or n if there is
+	// no smaller one.
+	Shrink(n uint64) uint64
+}
+
+// All policies here have one size per power of two, from
+// 2**minExponent up to 2**maxExponent, so sizes roughly
+// double from one step to the next.
+const minExponent = 3
+const maxExponent = 62
+
+type ladder struct {
+	size func(k uint) uint64 // in [2**k, 2**(k+1))
+}
+
+// Exponent of the biggest power of two <= n.
+func log2(n uint64) uint {
+	k := uint(0)
+	for n > 1 {
+		n >>= 1
+		k++
+	}
+	return k
+}
+
+func (self ladder) Initial() uint64 { return self.size(minExponent) }
+
+func (self ladder) Grow(n uint64) uint64 {
+	k := log2(n)
+	if k < minExponent {
+		return self.Initial()
+	}
+	for ; k <= maxExponent; k++ {
+		if s := self.size(k); s > n {
+			return s
+		}
+	}
+	return 0
+}
+
+func (self ladder) Shrink(n uint64) uint64 {
+	for k := log2(n); k >= minExponent; k-- {
+		if s := self.size(k); s < n {
+			return s
+		}
+	}
+	return n
+}
+
+// PowerOfTwo sizes are 8, 16, 32, ...
+var PowerOfTwo SizePolicy = ladder{func(k uint) uint64 {
+	return 1 << k
+}}
+
+// PrimesNearPowers sizes are the smallest primes above each
+// power of two: 11, 17, 37, 67, ...
+var PrimesNearPowers SizePolicy = ladder{func(k uint) uint64 {
+	return NextPrime(1<<k + 1)
+}}
+
+// PrimesBetweenPowers sizes are the smallest primes above
+// the midpoint between powers of two, as far from both as
+// possible: 13, 29, 53, 97, ...
+var PrimesBetweenPowers SizePolicy = ladder{func(k uint) uint64 {
+	return NextPrime(3 << (k - 1))
+}}
+
+// Fit returns the smallest size of policy p that holds n
+// entries with a load below load, or 0 if there is none.
+func Fit(p SizePolicy, n uint64, load float) uint64 {
+	s := p.Initial()
+	for s != 0 && float(n) >= float(s)*load {
+		s = p.Grow(s)
+	}
+	return s
+}
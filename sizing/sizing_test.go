@@ -0,0 +1,107 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sizing
+
+import "testing"
+
+// Trial division, slow but obviously right.
+func isPrimeSlow(n uint64) bool {
+	if n < 2 {
+		return false
+	}
+	for i := uint64(2); i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIsPrimeSmall(t *testing.T) {
+	for n := uint64(0); n < 100000; n++ {
+		if IsPrime(n) != isPrimeSlow(n) {
+			t.Errorf("IsPrime(%d) is %v", n, IsPrime(n))
+		}
+	}
+}
+
+func TestIsPrimeLarge(t *testing.T) {
+	primes := []uint64{
+		2147483659, 4294967311, 1099511627791,
+		18446744073709551557, // largest below 2**64
+	}
+	composites := []uint64{
+		3215031751,           // strong pseudoprime to bases 2, 3, 5, 7
+		3825123056546413051,  // ... to bases 2 through 23
+		18446744073709551615, // 2**64-1
+		4294967297,           // 2**32+1 = 641 * 6700417
+	}
+	for _, n := range primes {
+		if !IsPrime(n) {
+			t.Errorf("%d is prime", n)
+		}
+	}
+	for _, n := range composites {
+		if IsPrime(n) {
+			t.Errorf("%d is composite", n)
+		}
+	}
+}
+
+// The primes that used to be hardcoded in open/hashmap.go.
+var oldPrimes = []uint64{
+	17, 37, 67, 131, 257, 521, 1031, 2053, 4099, 8209, 16411,
+	32771, 65537, 131101, 262147, 524309, 1048583, 2097169,
+	4194319, 8388617, 16777259, 33554467, 67108879, 134217757,
+	268435459, 536870923, 1073741827, 2147483659,
+}
+
+func TestPrimesNearPowers(t *testing.T) {
+	s := PrimesNearPowers.Grow(16)
+	for _, p := range oldPrimes {
+		if s != p {
+			t.Errorf("expected %d, got %d", p, s)
+		}
+		s = PrimesNearPowers.Grow(s)
+	}
+	// and beyond 2**31
+	for s != 0 && s < 1<<40 {
+		if !IsPrime(s) {
+			t.Errorf("%d is not prime", s)
+		}
+		s = PrimesNearPowers.Grow(s)
+	}
+}
+
+func TestLadders(t *testing.T) {
+	for _, p := range []SizePolicy{PowerOfTwo, PrimesNearPowers, PrimesBetweenPowers} {
+		s := p.Initial()
+		for i := 0; i < 40; i++ {
+			g := p.Grow(s)
+			if g <= s || g > 3*s {
+				t.Errorf("Grow(%d) is %d", s, g)
+			}
+			if p.Shrink(g) != s {
+				t.Errorf("Shrink(%d) is %d, expected %d", g, p.Shrink(g), s)
+			}
+			s = g
+		}
+		if p.Shrink(p.Initial()) != p.Initial() {
+			t.Errorf("shrank below %d", p.Initial())
+		}
+		if p.Grow(1<<63) != 0 {
+			t.Errorf("grew past the last size")
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	if s := Fit(PowerOfTwo, 1000, 1.0); s != 1024 {
+		t.Errorf("expected 1024, got %d", s)
+	}
+	if s := Fit(PrimesNearPowers, 1000, 0.5); s != 2053 {
+		t.Errorf("expected 2053, got %d", s)
+	}
+}
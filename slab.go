@@ -0,0 +1,228 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+// A slab hands out chain nodes for the chained maps: the
+// buckets of HashMap and MultiMap, and the variants in
+// bucketlist/ and roger/. Nodes live in big chunks and link
+// to each other by index, so there is one allocation per
+// chunk instead of one per pair, and rehashing only relinks
+// indices. Freed nodes go on a free list threaded through
+// their next links.
+//
+// Index 0 is never handed out and means nil, so a freshly
+// made []int of chain heads is all empty chains.
+//
+// A slab can be copied like Snapshot() copies a HashMap:
+// after share() both copies start out with the same chunks,
+// and whichever writes to a chunk first copies just that one.
+
+const slabShift = 10
+const slabChunk = 1 << slabShift
+const slabMask = slabChunk - 1
+
+type slabNode struct {
+	pair	HashPair
+	next	int
+}
+
+type slab struct {
+	chunks	[][]slabNode
+	private	[]bool // chunks nobody else has, nil if all
+	shared	bool // chunks and private belong to a copy too
+	free	int // head of the free list
+	top	int // next index never handed out
+}
+
+// Start over with first as the first chunk. It may be
+// shorter than the others, it doubles until it's full size.
+func (self *slab) init(first []slabNode) {
+	self.chunks = [][]slabNode{first}
+	self.private = nil
+	self.shared = false
+	self.free = 0
+	self.top = 0
+}
+
+// Start over with room for n nodes in the first chunk.
+func (self *slab) initFor(n int) {
+	n++ // node 0 is nil
+	if n > slabChunk {
+		n = slabChunk
+	}
+	self.init(make([]slabNode, n))
+}
+
+// Node i, for reading only.
+func (self *slab) at(i int) *slabNode {
+	return &self.chunks[i>>slabShift][i&slabMask]
+}
+
+// Node i, made safe to change in place.
+func (self *slab) write(i int) *slabNode {
+	c := i >> slabShift
+	if self.shared {
+		self.unshare()
+	}
+	if self.private != nil && !self.private[c] {
+		d := make([]slabNode, len(self.chunks[c]))
+		copy(d, self.chunks[c])
+		self.chunks[c] = d
+		self.private[c] = true
+	}
+	return &self.chunks[c][i&slabMask]
+}
+
+// Mark the chunks as shared with a copy of the slab, which
+// can then be made with plain assignment.
+func (self *slab) share() {
+	self.shared = true
+}
+
+// The copy share() made is gone, and nothing shared our
+// chunks since before was taken, just before share(): the
+// chunks that were ours alone then are again, as are those
+// we copied since.
+func (self *slab) reclaim(before *slab) {
+	switch {
+	case before.shared:
+		// all but what we copied belong to an older copy too
+	case before.private == nil:
+		self.private = nil
+		self.shared = false
+	case self.shared:
+		// nothing copied since, the same chunks as before
+		self.private = before.private
+		self.shared = false
+	case self.private != nil:
+		for c, p := range before.private {
+			if p && c < len(self.private) {
+				self.private[c] = true
+			}
+		}
+	}
+}
+
+// Take a list of chunks of our own; none of the chunks is
+// ours alone any more.
+func (self *slab) unshare() {
+	c := make([][]slabNode, len(self.chunks), cap(self.chunks))
+	copy(c, self.chunks)
+	self.chunks = c
+	self.private = make([]bool, len(c), cap(c))
+	self.shared = false
+}
+
+// Hand out a node holding pair and linked to next.
+func (self *slab) alloc(pair HashPair, next int) int {
+	i := self.free
+	if i != 0 {
+		self.free = self.at(i).next
+	} else {
+		if self.top == 0 {
+			self.top = 1 // skip nil
+		}
+		i = self.top
+		self.extend(i)
+		self.top++
+	}
+	n := self.write(i)
+	n.pair = pair
+	n.next = next
+	return i
+}
+
+// Put node i on the free list.
+func (self *slab) release(i int) {
+	n := self.write(i)
+	n.pair = HashPair{} // let the GC have them
+	n.next = self.free
+	self.free = i
+}
+
+// Make room for node i, the first one never handed out.
+func (self *slab) extend(i int) {
+	c := i >> slabShift
+	if c == len(self.chunks) {
+		self.addChunk()
+	} else if i&slabMask == len(self.chunks[c]) {
+		self.regrow(c) // only the first chunk can be short
+	}
+}
+
+// Replace chunk c by a copy of our own, twice as long unless
+// it's full size already.
+func (self *slab) regrow(c int) {
+	l := 2 * len(self.chunks[c])
+	if l > slabChunk {
+		l = slabChunk
+	}
+	d := make([]slabNode, l)
+	copy(d, self.chunks[c])
+	if self.shared {
+		self.unshare()
+	}
+	self.chunks[c] = d
+	if self.private != nil {
+		self.private[c] = true
+	}
+}
+
+// The first chunk passed to init() is about to go away, or
+// to be reused: copy it out.
+func (self *slab) moveFirst() {
+	self.regrow(0)
+}
+
+// After the slab was copied along with the first chunk passed
+// to init(), make the copy use first, which holds the same.
+func (self *slab) relocate(first []slabNode) {
+	self.chunks = [][]slabNode{first}
+}
+
+func (self *slab) addChunk() {
+	if self.shared {
+		self.unshare()
+	}
+	l := len(self.chunks)
+	if l == cap(self.chunks) {
+		c := make([][]slabNode, l, 2*l+1)
+		copy(c, self.chunks)
+		self.chunks = c
+		if self.private != nil {
+			p := make([]bool, l, 2*l+1)
+			copy(p, self.private)
+			self.private = p
+		}
+	}
+	self.chunks = self.chunks[0 : l+1]
+	self.chunks[l] = make([]slabNode, slabChunk)
+	if self.private != nil {
+		self.private = self.private[0 : l+1]
+		self.private[l] = true
+	}
+}
+
+// A copy of the slab that shares no chunk with it.
+func (self *slab) clone() slab {
+	c := *self
+	c.chunks = make([][]slabNode, len(self.chunks))
+	for i, d := range self.chunks {
+		c.chunks[i] = make([]slabNode, len(d))
+		copy(c.chunks[i], d)
+	}
+	c.private = nil
+	c.shared = false
+	return c
+}
+
+// How many nodes the chunks hold, in use or not.
+func (self *slab) size() int {
+	n := 0
+	for _, d := range self.chunks {
+		n += len(d)
+	}
+	return n
+}
@@ -0,0 +1,109 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "testing"
+
+func TestSlabFreeList(t *testing.T) {
+	const Len = 3 * slabChunk
+	var s slab
+	for i := 1; i <= Len; i++ {
+		if n := s.alloc(HashPair{Integer(i), i}, 0); n != i {
+			t.Fatalf("expected node %d, got %d", i, n)
+		}
+	}
+	for i := 1; i <= Len; i += 2 {
+		s.release(i)
+	}
+	for i := 1; i <= Len; i++ {
+		p := s.at(i).pair
+		if (p.Key == nil) != (i%2 == 1) || (i%2 == 0 && p.Value.(int) != i) {
+			t.Fatalf("node %d holds %v after release", i, p)
+		}
+	}
+	size := s.size()
+	// the freed nodes come back, last freed first
+	for i := Len - 1; i >= 1; i -= 2 {
+		if n := s.alloc(HashPair{Integer(-i), -i}, 0); n != i {
+			t.Fatalf("expected freed node %d, got %d", i, n)
+		}
+	}
+	if s.size() != size {
+		t.Errorf("reusing freed nodes grew the slab from %d to %d", size, s.size())
+	}
+	if n := s.alloc(HashPair{}, 0); n != Len+1 {
+		t.Errorf("expected a new node %d once the free list is empty, got %d", Len+1, n)
+	}
+}
+
+// The first chunk starts short and doubles, its nodes keep
+// their contents.
+func TestSlabFirstChunk(t *testing.T) {
+	const Len = 2*slabChunk - 1
+	var s slab
+	s.init(make([]slabNode, 1))
+	for i := 1; i <= Len; i++ {
+		s.alloc(HashPair{Integer(i), i}, i-1)
+	}
+	if len(s.chunks) != 2 || len(s.chunks[0]) != slabChunk {
+		t.Errorf("expected 2 full chunks, got %d, the first %d long", len(s.chunks), len(s.chunks[0]))
+	}
+	for i := 1; i <= Len; i++ {
+		if n := s.at(i); n.pair.Value.(int) != i || n.next != i-1 {
+			t.Fatalf("node %d holds %v", i, *n)
+		}
+	}
+}
+
+func TestSlabShare(t *testing.T) {
+	const Len = 3 * slabChunk
+	var s slab
+	for i := 1; i <= Len; i++ {
+		s.alloc(HashPair{Integer(i), i}, 0)
+	}
+	s.share()
+	c := s
+	c.write(1).pair.Value = -1
+	c.release(2)
+	c.alloc(HashPair{Integer(0), 0}, 0)   // node 2 again
+	s.write(slabChunk + 1).pair.Value = 0 // another chunk
+	if &s.chunks[0][0] == &c.chunks[0][0] || &s.chunks[2][0] != &c.chunks[2][0] {
+		t.Errorf("expected only the written chunks to be copied")
+	}
+	if s.at(1).pair.Value.(int) != 1 || s.at(2).pair.Value.(int) != 2 || c.at(slabChunk+1).pair.Value.(int) != slabChunk+1 {
+		t.Errorf("writes to one copy show up in the other")
+	}
+	if s.alloc(HashPair{}, 0) != Len+1 || c.alloc(HashPair{}, 0) != Len+1 {
+		t.Errorf("the copies don't hand out nodes on their own")
+	}
+}
+
+// Resizing a HashMap leaves every pair in its node, and
+// allocates nothing but the new table.
+func TestSlabRelink(t *testing.T) {
+	const Len = 1000
+	a := New()
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	nodes := make([]int, Len)
+	for i := range nodes {
+		_, nodes[i] = a.find(Integer(i))
+	}
+	size := a.nodes.size()
+	before := mallocs()
+	a.Reserve(16 * Len)
+	if m := mallocs() - before; m != 1 {
+		t.Errorf("expected Reserve to allocate just the table, got %d allocations", m)
+	}
+	if a.nodes.size() != size {
+		t.Errorf("Reserve changed the slab from %d to %d nodes", size, a.nodes.size())
+	}
+	for i := range nodes {
+		if _, p := a.find(Integer(i)); p != nodes[i] {
+			t.Fatalf("%d moved from node %d to %d", i, nodes[i], p)
+		}
+	}
+}
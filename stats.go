@@ -0,0 +1,74 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "fmt"
+import "io"
+
+// Stats describes the shape of a hash table. Fields that
+// don't apply to a map implementation are left zero.
+type Stats struct {
+	Buckets		int
+	Entries		int
+	LoadFactor	float
+	// ChainLengths[n] is the number of buckets holding n
+	// pairs, for chained maps.
+	ChainLengths	[]int
+	// ProbeLengths[n] is the number of pairs found n slots
+	// past their home slot, for open addressing maps.
+	ProbeLengths	[]int
+	// Deleted slots still taking up room.
+	Tombstones	int
+	// Estimated memory used by the table itself, not
+	// counting what keys and values point to.
+	Bytes		int
+	// Resizes since the map was initialized.
+	Grows		int
+	Shrinks		int
+}
+
+// Add one to bin n of histogram h, growing h as needed.
+func histogram(h []int, n int) []int {
+	if n >= len(h) {
+		x := make([]int, n+1)
+		copy(x, h)
+		h = x
+	}
+	h[n]++
+	return h
+}
+
+const dumpWidth = 64
+
+// Write a header and then one character per bucket, as
+// returned by cell, dumpWidth buckets to a line.
+func dump(w io.Writer, s Stats, cell func(i int) byte) {
+	fmt.Fprintf(w, "%d buckets, %d entries, ", s.Buckets, s.Entries)
+	if s.Tombstones > 0 {
+		fmt.Fprintf(w, "%d deleted, ", s.Tombstones)
+	}
+	fmt.Fprintf(w, "load %.3f\n", s.LoadFactor)
+	line := make([]byte, dumpWidth+1)
+	for i := 0; i < s.Buckets; i += dumpWidth {
+		n := 0
+		for ; n < dumpWidth && i+n < s.Buckets; n++ {
+			line[n] = cell(i + n)
+		}
+		line[n] = '\n'
+		fmt.Fprintf(w, "%8d ", i)
+		w.Write(line[0 : n+1])
+	}
+}
+
+// The cell for a chain of length n.
+func chainCell(n int) byte {
+	switch {
+	case n == 0:
+		return '.'
+	case n < 10:
+		return byte('0' + n)
+	}
+	return '+'
+}
@@ -0,0 +1,231 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+//import "fmt"
+import "bytes"
+import "io"
+import "unicode"
+import "utf8"
+
+// Hasher hashes and compares keys on their behalf, so keys
+// don't have to implement Hashable: strings, []byte, ints,
+// or structs of which only some fields matter. Keys that
+// are Equal must have the same Hash.
+type Hasher interface {
+	Hash(key interface{}) uint64
+	Equal(a, b interface{}) bool
+}
+
+// StrategyMap is a HashMap whose keys are hashed and compared
+// by a Hasher instead of by themselves.
+// You must call Init() before using it.
+type StrategyMap struct {
+	m	HashMap // hashedKey -> value
+	hasher	Hasher
+}
+
+// The hidden Hashable a StrategyMap wraps its keys into. The
+// hash is taken once and compared first, so the Hasher's
+// Equal mostly runs on keys that do match.
+type hashedKey struct {
+	key	interface{}
+	hash	uint
+	hasher	Hasher
+}
+
+func (self hashedKey) Hash() uint { return self.hash }
+
+func (self hashedKey) Equal(other Hashable) bool {
+	o := other.(hashedKey)
+	return self.hash == o.hash && self.hasher.Equal(self.key, o.key)
+}
+
+func (self *StrategyMap) wrap(key interface{}) hashedKey {
+	h := self.hasher.Hash(key)
+	return hashedKey{key, uint(h) ^ uint(h>>32), self.hasher}
+}
+
+// Init initializes or clears a StrategyMap using h.
+func (self *StrategyMap) Init(h Hasher) *StrategyMap {
+//	fmt.Printf("Init %s\n", self)
+	self.m.Init()
+	self.hasher = h
+	return self
+}
+
+// NewWithHasher returns an initialized StrategyMap using h.
+func NewWithHasher(h Hasher) *StrategyMap {
+//	fmt.Printf("NewWithHasher\n")
+	return new(StrategyMap).Init(h)
+}
+
+func (self *StrategyMap) Insert(key interface{}, value interface{}) {
+//	fmt.Printf("Insert %s->%s\n", key, value)
+	self.m.Insert(self.wrap(key), value)
+}
+
+func (self *StrategyMap) Remove(key interface{}) {
+//	fmt.Printf("Remove %s\n", key)
+	self.m.Remove(self.wrap(key))
+}
+
+func (self *StrategyMap) At(key interface{}) interface{} {
+//	fmt.Printf("At %s\n", key)
+	return self.m.At(self.wrap(key))
+}
+
+func (self *StrategyMap) Set(key interface{}, value interface{}) {
+//	fmt.Printf("Set %s->%s\n", key, value)
+	self.m.Set(self.wrap(key), value)
+}
+
+func (self *StrategyMap) Has(key interface{}) bool {
+//	fmt.Printf("Has %s\n", key)
+	return self.m.Has(self.wrap(key))
+}
+
+func (self *StrategyMap) Len() int {
+//	fmt.Printf("Len %d\n", self.m.Len())
+	return self.m.Len()
+}
+
+// Stats describes the underlying HashMap; the Hasher's hashes
+// decide the chains.
+func (self *StrategyMap) Stats() Stats {
+//	fmt.Printf("Stats\n")
+	return self.m.Stats()
+}
+
+// Dump writes the chains of the underlying HashMap to w.
+func (self *StrategyMap) Dump(w io.Writer) {
+//	fmt.Printf("Dump\n")
+	self.m.Dump(w)
+}
+
+// Do calls f with every key as it was inserted.
+func (self *StrategyMap) Do(f func(key interface{}, value interface{})) {
+//	fmt.Printf("Do %s\n", f)
+	self.m.Do(func(key Hashable, value interface{}) {
+		f(key.(hashedKey).key, value)
+	})
+}
+
+// Range calls f for every pair until f returns false.
+func (self *StrategyMap) Range(f func(key interface{}, value interface{}) bool) {
+//	fmt.Printf("Range %s\n", f)
+	self.m.Range(func(key Hashable, value interface{}) bool {
+		return f(key.(hashedKey).key, value)
+	})
+}
+
+// FNV-1a, 64 bit.
+const fnvOffset = 14695981039346656037
+const fnvPrime = 1099511628211
+
+// StringHasher hashes and compares strings exactly.
+var StringHasher Hasher = stringHasher{}
+
+type stringHasher struct{}
+
+func (stringHasher) Hash(key interface{}) uint64 {
+	s := key.(string)
+	h := uint64(fnvOffset)
+	for i := 0; i < len(s); i++ {
+		h = (h ^ uint64(s[i])) * fnvPrime
+	}
+	return h
+}
+
+func (stringHasher) Equal(a, b interface{}) bool { return a.(string) == b.(string) }
+
+// FoldedStringHasher hashes and compares strings ignoring
+// case, so "Go", "GO" and "go" are the same key.
+var FoldedStringHasher Hasher = foldedStringHasher{}
+
+type foldedStringHasher struct{}
+
+// Map all cases of a letter to one of them.
+func fold(c int) int { return unicode.ToLower(unicode.ToUpper(c)) }
+
+func (foldedStringHasher) Hash(key interface{}) uint64 {
+	h := uint64(fnvOffset)
+	for _, c := range key.(string) {
+		h = (h ^ uint64(fold(c))) * fnvPrime
+	}
+	return h
+}
+
+func (foldedStringHasher) Equal(a, b interface{}) bool {
+	s, t := a.(string), b.(string)
+	for len(s) > 0 && len(t) > 0 {
+		c, n := utf8.DecodeRuneInString(s)
+		d, m := utf8.DecodeRuneInString(t)
+		if fold(c) != fold(d) {
+			return false
+		}
+		s, t = s[n:], t[m:]
+	}
+	return len(s) == len(t)
+}
+
+// BytesHasher hashes and compares []byte keys by content.
+// Don't change a key's bytes while it is in a map.
+var BytesHasher Hasher = bytesHasher{}
+
+type bytesHasher struct{}
+
+func (bytesHasher) Hash(key interface{}) uint64 {
+	h := uint64(fnvOffset)
+	for _, c := range key.([]byte) {
+		h = (h ^ uint64(c)) * fnvPrime
+	}
+	return h
+}
+
+func (bytesHasher) Equal(a, b interface{}) bool { return bytes.Equal(a.([]byte), b.([]byte)) }
+
+// IntHasher hashes and compares keys of any of the integer
+// types. Keys of different types are never equal, even if
+// their values are.
+var IntHasher Hasher = intHasher{}
+
+type intHasher struct{}
+
+func (intHasher) Hash(key interface{}) uint64 {
+	var x uint64
+	switch k := key.(type) {
+	case int:
+		x = uint64(k)
+	case int8:
+		x = uint64(k)
+	case int16:
+		x = uint64(k)
+	case int32:
+		x = uint64(k)
+	case int64:
+		x = uint64(k)
+	case uint:
+		x = uint64(k)
+	case uint8:
+		x = uint64(k)
+	case uint16:
+		x = uint64(k)
+	case uint32:
+		x = uint64(k)
+	case uint64:
+		x = k
+	case uintptr:
+		x = uint64(k)
+	default:
+		panic("IntHasher.Hash: not an integer")
+	}
+	// Fibonacci hashing like IntMap, so the low bits that
+	// pick the bucket depend on all bits of the key
+	x *= intMultiplier
+	return x ^ x>>32
+}
+
+func (intHasher) Equal(a, b interface{}) bool { return a == b }
@@ -0,0 +1,109 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "testing"
+
+func TestFoldedStrings(t *testing.T) {
+	a := NewWithHasher(FoldedStringHasher)
+	a.Insert("Go", 1)
+	a.Insert("Straße", 2)
+	for _, k := range []string{"go", "GO", "gO"} {
+		if !a.Has(k) || a.At(k).(int) != 1 {
+			t.Errorf("%q not found", k)
+		}
+	}
+	if a.Has("STRASSE") || !a.Has("STRAßE") {
+		t.Errorf("expected only STRAßE to match Straße")
+	}
+	if a.Has("Gopher") || a.Has("G") {
+		t.Errorf("prefixes match")
+	}
+	a.Set("GO", 3)
+	a.Do(func(key interface{}, value interface{}) {
+		if key.(string) == "Go" && value.(int) != 3 {
+			t.Errorf("expected 3 under the key as inserted, got %d", value)
+		}
+	})
+	a.Remove("go")
+	if a.Len() != 1 {
+		t.Errorf("expected 1, got %d", a.Len())
+	}
+}
+
+func TestExactStrings(t *testing.T) {
+	a := NewWithHasher(StringHasher)
+	a.Insert("Go", 1)
+	a.Insert("go", 2)
+	if a.At("Go").(int) != 1 || a.At("go").(int) != 2 || a.Has("GO") {
+		t.Errorf("exact strings got folded")
+	}
+}
+
+func TestStrategyStats(t *testing.T) {
+	const Len = 1000
+	a := NewWithHasher(IntHasher)
+	for i := 0; i < Len; i++ {
+		a.Insert(i, i)
+	}
+	if s := a.Stats(); s.Entries != Len || s.Buckets != len(a.m.data) || s.Grows == 0 {
+		t.Errorf("expected the Stats of the HashMap, got %v", s)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	a := NewWithHasher(BytesHasher)
+	a.Insert([]byte("key"), 1)
+	if !a.Has([]byte{'k', 'e', 'y'}) || a.Has([]byte("ke")) {
+		t.Errorf("[]byte keys compared by identity")
+	}
+}
+
+func TestInts(t *testing.T) {
+	const Len = 1000
+	a := NewWithHasher(IntHasher)
+	for i := 0; i < Len; i++ {
+		a.Insert(i, i)
+		a.Insert(int64(i), -i)
+	}
+	for i := 0; i < Len; i++ {
+		if a.At(i).(int) != i || a.At(int64(i)).(int) != -i {
+			t.Errorf("%d mixed up with int64(%d)", i, i)
+		}
+	}
+	if a.Has(uint8(1)) {
+		t.Errorf("uint8(1) found")
+	}
+}
+
+// Only the name of a person is the key.
+type person struct {
+	name	string
+	age	int
+}
+
+type byName struct{}
+
+func (byName) Hash(key interface{}) uint64 { return StringHasher.Hash(key.(person).name) }
+func (byName) Equal(a, b interface{}) bool { return a.(person).name == b.(person).name }
+
+func TestStructSubset(t *testing.T) {
+	a := NewWithHasher(byName{})
+	a.Insert(person{"Ada", 36}, true)
+	if !a.Has(person{"Ada", 0}) || a.Has(person{"Bob", 36}) {
+		t.Errorf("compared more than the name")
+	}
+	n := 0
+	a.Range(func(key interface{}, value interface{}) bool {
+		if key.(person).age != 36 {
+			t.Errorf("expected the key as inserted, got %v", key)
+		}
+		n++
+		return true
+	})
+	if n != 1 {
+		t.Errorf("expected 1 pair, got %d", n)
+	}
+}
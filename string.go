@@ -0,0 +1,20 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "utf8"
+
+// HashBytes returns String(b).Hash() without converting b.
+// It decodes b like range does a string, bytes that aren't
+// UTF-8 count as utf8.RuneError each.
+func HashBytes(b []byte) uint {
+	var h uint = 5381
+	for len(b) > 0 {
+		r, n := utf8.DecodeRune(b)
+		h = (h << 5) + h + uint(r)
+		b = b[n:]
+	}
+	return h
+}
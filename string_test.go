@@ -0,0 +1,87 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "rand"
+import "runtime"
+import "strconv"
+import "testing"
+
+func TestHashBytes(t *testing.T) {
+	keys := []string{
+		"", "a", "hello, world", "Straße", "日本語",
+		"\xff", "a\xffb", "\xc0\x80", // invalid, overlong
+		"\xe2\x82", "\xe2\x82\xac\xe2", // truncated
+		"\xed\xa0\x80", // surrogate
+		"\xf4\x90\x80\x80", // past U+10FFFF
+	}
+	for _, k := range keys {
+		if h := HashBytes([]byte(k)); h != String(k).Hash() {
+			t.Errorf("HashBytes(%q) is %d, Hash() is %d", k, h, String(k).Hash())
+		}
+	}
+	rand.Seed(1)
+	b := make([]byte, 16)
+	for i := 0; i < 10000; i++ {
+		n := rand.Intn(len(b))
+		for j := 0; j < n; j++ {
+			b[j] = byte(rand.Intn(256))
+		}
+		if HashBytes(b[0:n]) != String(b[0:n]).Hash() {
+			t.Errorf("HashBytes(%q) differs from Hash()", b[0:n])
+		}
+	}
+}
+
+func keyName(i int) string { return "k" + strconv.Itoa(i) }
+
+func TestAtBytes(t *testing.T) {
+	for _, n := range []int{smallSize, 1000} {
+		a := New()
+		for i := 0; i < n; i++ {
+			a.Insert(String(keyName(i)), i)
+		}
+		for i := 0; i < n; i++ {
+			b := []byte(keyName(i))
+			if !a.HasBytes(b) || a.AtBytes(b).(int) != i {
+				t.Errorf("%s not found", b)
+			}
+			v, ok := a.LookupWith(HashBytes(b), func(key Hashable) bool {
+				s, ok := key.(String)
+				return ok && string(s) == string(b)
+			})
+			if !ok || v.(int) != i {
+				t.Errorf("LookupWith didn't find %s", b)
+			}
+		}
+		if a.HasBytes([]byte("missing")) {
+			t.Errorf("found missing")
+		}
+	}
+}
+
+func mallocs() uint64 {
+	return runtime.MemStats.Mallocs
+}
+
+func TestBytesDontAllocate(t *testing.T) {
+	const Rounds = 1000
+	for _, n := range []int{smallSize, 1000} {
+		a := New()
+		for i := 0; i < n; i++ {
+			a.Insert(String(keyName(i)), i)
+		}
+		hit, miss := []byte(keyName(1)), []byte("missing")
+		before := mallocs()
+		for i := 0; i < Rounds; i++ {
+			a.HasBytes(hit)
+			a.AtBytes(hit)
+			a.HasBytes(miss)
+		}
+		if m := mallocs() - before; m != 0 {
+			t.Errorf("%d lookups in %d pairs allocated %d times", 3*Rounds, n, m)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+// Like Java 8's HashMap, buckets that get long despite the
+// load factor (a weak or attacked hash function) turn into
+// balanced trees, so lookups stay O(log n) in the worst
+// case. That only works if the keys can be ordered.
+
+// Ordered keys can be compared as well as hashed. It's like
+// maps.Ordered, but Equal() and Less() take Hashables. Less
+// has to be a strict total order that agrees with Equal; it
+// only ever gets keys of its own type, trees don't mix them.
+type Ordered interface {
+	Hashable
+	Less(other Hashable) bool
+}
+
+// Treeify buckets that get this long, untreeify them when
+// they get shorter than untreeifyLength. The gap keeps a
+// bucket from flipping back and forth.
+const treeifyLength = 8
+const untreeifyLength = 6
+
+// An AVL tree indexing the pairs of one bucket, which stay
+// where they are; pos says where to find them.
+type treeNode struct {
+	key		Ordered
+	pos		int
+	left, right	*treeNode
+	height		int
+}
+
+// Build a tree over pairs, or return nil if one of their
+// keys isn't Ordered or they aren't all of one type.
+func buildTree(pairs []HashPair) *treeNode {
+	var t *treeNode
+	for i, e := range pairs {
+		k, ok := e.Key.(Ordered)
+		if !ok || !sameType(e.Key, pairs[0].Key) {
+			return nil
+		}
+		t = treeInsert(t, k, i)
+	}
+	return t
+}
+
+func treeHeight(t *treeNode) int {
+	if t == nil {
+		return 0
+	}
+	return t.height
+}
+
+func (self *treeNode) fix() {
+	l, r := treeHeight(self.left), treeHeight(self.right)
+	if l > r {
+		self.height = l + 1
+	} else {
+		self.height = r + 1
+	}
+}
+
+func rotateRight(t *treeNode) *treeNode {
+	l := t.left
+	t.left = l.right
+	l.right = t
+	t.fix()
+	l.fix()
+	return l
+}
+
+func rotateLeft(t *treeNode) *treeNode {
+	r := t.right
+	t.right = r.left
+	r.left = t
+	t.fix()
+	r.fix()
+	return r
+}
+
+// Restore the AVL property at t after one of its subtrees
+// changed height by one; returns the new root.
+func rebalance(t *treeNode) *treeNode {
+	t.fix()
+	switch d := treeHeight(t.left) - treeHeight(t.right); {
+	case d > 1:
+		if treeHeight(t.left.left) < treeHeight(t.left.right) {
+			t.left = rotateLeft(t.left)
+		}
+		return rotateRight(t)
+	case d < -1:
+		if treeHeight(t.right.right) < treeHeight(t.right.left) {
+			t.right = rotateRight(t.right)
+		}
+		return rotateLeft(t)
+	}
+	return t
+}
+
+// Returns the node for key or nil.
+func (self *treeNode) get(key Ordered) *treeNode {
+	t := self
+	for t != nil {
+		switch {
+		case key.Less(t.key):
+			t = t.left
+		case t.key.Less(key):
+			t = t.right
+		default:
+			return t
+		}
+	}
+	return nil
+}
+
+// Add key, which mustn't be in t yet; returns the new root.
+func treeInsert(t *treeNode, key Ordered, pos int) *treeNode {
+	if t == nil {
+		return &treeNode{key: key, pos: pos, height: 1}
+	}
+	if key.Less(t.key) {
+		t.left = treeInsert(t.left, key, pos)
+	} else {
+		t.right = treeInsert(t.right, key, pos)
+	}
+	return rebalance(t)
+}
+
+// Drop key, which has to be in t; returns the new root.
+func treeRemove(t *treeNode, key Ordered) *treeNode {
+	switch {
+	case key.Less(t.key):
+		t.left = treeRemove(t.left, key)
+	case t.key.Less(key):
+		t.right = treeRemove(t.right, key)
+	default:
+		if t.left == nil {
+			return t.right
+		}
+		if t.right == nil {
+			return t.left
+		}
+		// replace t by the smallest node on its right
+		m := t.right
+		for m.left != nil {
+			m = m.left
+		}
+		m.right = treeRemoveMin(t.right)
+		m.left = t.left
+		t = m
+	}
+	return rebalance(t)
+}
+
+func treeRemoveMin(t *treeNode) *treeNode {
+	if t.left == nil {
+		return t.right
+	}
+	t.left = treeRemoveMin(t.left)
+	return rebalance(t)
+}
@@ -0,0 +1,134 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+//import "fmt"
+
+// Txn is a batch of changes to a HashMap that either all
+// stay, with Commit, or all go, with Rollback. Begin takes a
+// Snapshot; the buckets the batch writes to get copied, so
+// the snapshot keeps their old contents as an undo log, and
+// Rollback puts it back, table size and all. Lookups see
+// the batch's own writes. So do changes made to the map
+// directly while the Txn is open, and they are rolled back
+// along with it. Observers hear about the changes on Commit,
+// or never.
+//
+// To undo a batch that panics halfway:
+//
+//	t := m.Begin()
+//	defer t.Rollback()
+//	... t.Insert(), t.Set(), t.Remove() ...
+//	t.Commit()
+type Txn struct {
+	m	*HashMap
+	saved	*HashMap
+	done	bool
+	since	*owner // the map's after Begin, until it's snapshotted again
+	// what the map shared before Begin
+	owner	*owner
+	tableShared	bool
+	nodes	slab
+}
+
+// Begin starts a Txn on the map.
+func (self *HashMap) Begin() *Txn {
+//	fmt.Printf("Begin\n")
+	t := &Txn{m: self, owner: self.owner, tableShared: self.tableShared, nodes: self.nodes}
+	t.saved = self.Snapshot()
+	t.since = self.owner
+	self.watch.held = true
+	return t
+}
+
+// Whether the map was snapshotted since Begin.
+func (self *Txn) snapshotted() bool {
+	return self.m.owner != self.since
+}
+
+// The snapshot Begin took is gone, and the map wasn't
+// snapshotted again: what it shared with nobody else before
+// Begin is its own again, so its next writes don't copy the
+// table, the trees or the chunks.
+func (self *Txn) giveBack() {
+	m := self.m
+	m.owner = self.owner
+	m.tableShared = m.tableShared && self.tableShared
+	m.nodes.reclaim(&self.nodes)
+}
+
+// Make self exactly what from was, keeping the observers but
+// not the changes they haven't been told about.
+func (self *HashMap) restore(from *HashMap) {
+	list := self.watch.list
+	*self = *from
+	self.watch = observers{list: list}
+	self.rebind()
+}
+
+func (self *Txn) check() {
+	if self.done {
+		panic("Txn: already finished")
+	}
+}
+
+// Commit keeps all changes.
+func (self *Txn) Commit() {
+//	fmt.Printf("Commit\n")
+	self.check()
+	self.done = true
+	if !self.snapshotted() {
+		self.giveBack()
+	}
+	self.saved = nil
+	self.m.watch.held = false
+	self.m.watch.flush()
+}
+
+// Rollback undoes all changes since Begin. After Commit it
+// does nothing, so it can be deferred.
+func (self *Txn) Rollback() {
+//	fmt.Printf("Rollback\n")
+	if self.done {
+		return
+	}
+	self.done = true
+	again := self.snapshotted()
+	self.m.restore(self.saved)
+	if !again {
+		self.giveBack()
+	}
+	self.saved = nil
+}
+
+func (self *Txn) Insert(key Hashable, value interface{}) {
+	self.check()
+	self.m.Insert(key, value)
+}
+
+func (self *Txn) Remove(key Hashable) {
+	self.check()
+	self.m.Remove(key)
+}
+
+func (self *Txn) Set(key Hashable, value interface{}) {
+	self.check()
+	self.m.Set(key, value)
+}
+
+func (self *Txn) At(key Hashable) interface{} {
+	self.check()
+	return self.m.At(key)
+}
+
+func (self *Txn) Has(key Hashable) bool {
+	self.check()
+	return self.m.Has(key)
+}
+
+func (self *Txn) Len() int {
+	self.check()
+	return self.m.Len()
+}
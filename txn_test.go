@@ -0,0 +1,198 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+import "testing"
+
+func TestRollback(t *testing.T) {
+	const Len = 1000
+	same := func(i int) int { return i }
+	for _, n := range []int{0, smallSize / 2, Len} {
+		a := New()
+		for i := 0; i < n; i++ {
+			a.Insert(Integer(i), i)
+		}
+		before := a.Stats()
+
+		x := a.Begin()
+		for i := 0; i < n; i += 2 {
+			x.Remove(Integer(i)) // shrinks
+		}
+		for i := n; i < 4*Len; i++ {
+			x.Insert(Integer(i), i) // grows
+		}
+		for i := 1; i < n; i += 2 {
+			x.Set(Integer(i), -i)
+		}
+		if (n > 0 && x.Has(Integer(0))) || x.Len() != n/2+4*Len-n {
+			t.Errorf("%d: Txn doesn't see its own writes", n)
+		}
+		x.Rollback()
+
+		after := a.Stats()
+		if after.Buckets != before.Buckets || after.Grows != before.Grows || after.Shrinks != before.Shrinks {
+			t.Errorf("%d: expected %v after Rollback, got %v", n, before, after)
+		}
+		if !holds(a, 4*Len, func(i int) bool { return i < n }, same) {
+			t.Errorf("%d: Rollback didn't restore the pairs", n)
+		}
+		a.Insert(Integer(-1), -1) // still works
+		if a.At(Integer(-1)).(int) != -1 {
+			t.Errorf("%d: map broken after Rollback", n)
+		}
+	}
+}
+
+// A small map that has been hashed before keeps its resize
+// counts through a Rollback.
+func TestRollbackStats(t *testing.T) {
+	a := New()
+	for i := 0; i < 100; i++ {
+		a.Insert(Integer(i), i)
+	}
+	for i := 1; i < 100; i++ {
+		a.Remove(Integer(i))
+	}
+	before := a.Stats()
+	x := a.Begin()
+	x.Insert(Integer(1), 1)
+	x.Rollback()
+	after := a.Stats()
+	if !a.small || before.Grows == 0 || after.Buckets != before.Buckets || after.Entries != before.Entries || after.Grows != before.Grows || after.Shrinks != before.Shrinks {
+		t.Errorf("expected %v after Rollback, got %v", before, after)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	const Len = 100
+	a := New()
+	x := a.Begin()
+	for i := 0; i < Len; i++ {
+		x.Insert(Integer(i), i)
+	}
+	x.Commit()
+	x.Rollback() // no-op after Commit
+	if !holds(a, Len, func(i int) bool { return true }, func(i int) int { return i }) {
+		t.Errorf("Commit lost pairs")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Errorf("expected a panic using a finished Txn")
+		}
+	}()
+	x.Insert(Integer(Len), Len)
+}
+
+// Where each chunk of nodes starts.
+func chunkAddrs(a *HashMap) []*slabNode {
+	p := make([]*slabNode, len(a.nodes.chunks))
+	for c := range p {
+		p[c] = &a.nodes.chunks[c][0]
+	}
+	return p
+}
+
+// Once a Txn is over the map has its table and chunks to
+// itself again, unless it was snapshotted before or during
+// the Txn; then the snapshots keep what they had.
+func TestTxnGivesBack(t *testing.T) {
+	const Len = 4 * slabChunk
+	for _, commit := range []bool{true, false} {
+		for _, snap := range []string{"", "before", "during"} {
+			a := New()
+			a.SetAutoShrink(false)
+			for i := 0; i < Len; i++ {
+				a.Insert(Integer(i), i)
+			}
+			var s *HashMap
+			if snap == "before" {
+				s = a.Snapshot()
+			}
+			x := a.Begin()
+			x.Set(Integer(0), -1)
+			if snap == "during" {
+				s = a.Snapshot()
+			}
+			if commit {
+				x.Commit()
+			} else {
+				x.Rollback()
+			}
+			d, chunks := &a.data[0], chunkAddrs(a)
+			for i := 1; i < Len; i += 2 {
+				a.Remove(Integer(i))
+			}
+			if s != nil {
+				for i := 1; i < Len; i++ {
+					if s.At(Integer(i)).(int) != i {
+						t.Fatalf("%v %s: write after the Txn shows in the snapshot", commit, snap)
+					}
+				}
+				continue
+			}
+			if &a.data[0] != d {
+				t.Errorf("%v: write after the Txn copied the table", commit)
+			}
+			for c, p := range chunkAddrs(a) {
+				if p != chunks[c] {
+					t.Errorf("%v: write after the Txn copied chunk %d", commit, c)
+				}
+			}
+		}
+	}
+}
+
+// A batch that panics halfway leaves the map as it was.
+func TestRollbackOnPanic(t *testing.T) {
+	const Len = 100
+	a := New()
+	for i := 0; i < Len; i++ {
+		a.Insert(Integer(i), i)
+	}
+	apply := func() {
+		x := a.Begin()
+		defer x.Rollback()
+		for i := 0; i < 2*Len; i++ {
+			x.Set(Integer(i), -i) // panics at Len
+		}
+		x.Commit()
+	}
+	func() {
+		defer func() { recover() }()
+		apply()
+	}()
+	if !holds(a, 2*Len, func(i int) bool { return i < Len }, func(i int) int { return i }) {
+		t.Errorf("half a batch stayed")
+	}
+}
+
+// Observers hear about a Txn's changes on Commit only.
+func TestTxnObserve(t *testing.T) {
+	const Len = 100
+	a := New()
+	m := newMirror(t, a)
+	a.Observe(m.observer())
+	x := a.Begin()
+	for i := 0; i < Len; i++ {
+		x.Insert(Int(i), i)
+	}
+	if m.changes != 0 {
+		t.Errorf("observers told about %d changes before Commit", m.changes)
+	}
+	x.Commit()
+	m.check("after Commit", a)
+
+	x = a.Begin()
+	for i := 0; i < Len; i++ {
+		x.Remove(Int(i))
+	}
+	x.Rollback()
+	if m.changes != Len {
+		t.Errorf("observers told about changes that were rolled back")
+	}
+	m.check("after Rollback", a)
+	a.Remove(Int(0)) // still observed
+	m.check("after Rollback and Remove", a)
+}
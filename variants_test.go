@@ -0,0 +1,184 @@
+// Copyright 2009 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hashmap
+
+// These tests only use the API that every map variant has:
+// this package, open/, bucketlist/ and roger/. Each of those
+// has a symlink to this file, so gotest there runs it too.
+
+import "bytes"
+import "testing"
+
+// Few distinct hashes, so chains and probe runs get long.
+type collider int
+
+func (self collider) Hash() uint { return uint(self % 7) }
+func (self collider) Equal(other Hashable) bool { return self == other.(collider) }
+
+// Few distinct hashes too, but ordered, so variants that
+// turn long chains into trees do.
+type orderedCollider int
+
+func (self orderedCollider) Hash() uint { return uint(self % 3) }
+func (self orderedCollider) Equal(other Hashable) bool { return self == other.(orderedCollider) }
+func (self orderedCollider) Less(other Hashable) bool { return self < other.(orderedCollider) }
+
+func variantMap(n int) *HashMap {
+	m := New()
+	for i := 0; i < 2*n; i++ {
+		m.Insert(collider(i), i)
+	}
+	// leave holes so removal paths are covered too
+	for i := 0; i < 2*n; i += 2 {
+		m.Remove(collider(i))
+	}
+	return m
+}
+
+func TestDoVisitsAll(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000} {
+		m := variantMap(n)
+		seen := make(map[collider]bool)
+		m.Do(func(key Hashable, value interface{}) {
+			k := key.(collider)
+			if seen[k] {
+				t.Errorf("Do visited %d twice", k)
+			}
+			if int(k) != value.(int) || k%2 != 1 {
+				t.Errorf("Do visited bad pair %d->%d", k, value)
+			}
+			seen[k] = true
+		})
+		if len(seen) != m.Len() || m.Len() != n {
+			t.Errorf("Do visited %d, Len() is %d, expected %d", len(seen), m.Len(), n)
+		}
+	}
+}
+
+func TestRangeVisitsAll(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000} {
+		m := variantMap(n)
+		i := 0
+		m.Range(func(key Hashable, value interface{}) bool {
+			i++
+			return true
+		})
+		if i != m.Len() {
+			t.Errorf("Range visited %d, Len() is %d", i, m.Len())
+		}
+	}
+}
+
+func TestRangeStops(t *testing.T) {
+	const Len = 1000
+	m := variantMap(Len)
+	for _, stop := range []int{1, 2, Len / 2, Len} {
+		i := 0
+		m.Range(func(key Hashable, value interface{}) bool {
+			i++
+			return i < stop
+		})
+		if i != stop {
+			t.Errorf("Range visited %d, expected to stop at %d", i, stop)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000} {
+		m := variantMap(n)
+		s := m.Stats()
+		if s.Entries != m.Len() || (s.Buckets == 0 && s.Entries > 0) {
+			t.Errorf("Stats has %d entries in %d buckets, Len() is %d", s.Entries, s.Buckets, m.Len())
+		}
+		// every pair is in exactly one chain or probe bin
+		pairs := 0
+		for l, c := range s.ChainLengths {
+			pairs += l * c
+		}
+		for _, c := range s.ProbeLengths {
+			pairs += c
+		}
+		if pairs != m.Len() {
+			t.Errorf("histograms hold %d pairs, Len() is %d", pairs, m.Len())
+		}
+		if s.Bytes <= 0 {
+			t.Errorf("estimated %d bytes", s.Bytes)
+		}
+
+		var b bytes.Buffer
+		m.Dump(&b)
+		lines := bytes.Count(b.Bytes(), []byte{'\n'})
+		if expected := 1 + (s.Buckets+dumpWidth-1)/dumpWidth; lines != expected {
+			t.Errorf("Dump wrote %d lines, expected %d", lines, expected)
+		}
+	}
+}
+
+func TestLongChains(t *testing.T) {
+	const Len = 1000
+	m := New()
+	check := func(phase string, has func(i int) bool) {
+		n := 0
+		for i := 0; i < Len; i++ {
+			k := orderedCollider(i)
+			switch {
+			case m.Has(k) != has(i):
+				t.Fatalf("%s: Has(%d) is %v", phase, i, m.Has(k))
+			case has(i):
+				if m.At(k).(int) != i {
+					t.Fatalf("%s: At(%d) is %v", phase, i, m.At(k))
+				}
+				n++
+			}
+		}
+		if m.Len() != n {
+			t.Fatalf("%s: expected %d, got %d", phase, n, m.Len())
+		}
+	}
+	// scramble the order so trees see every shape
+	for i := 0; i < Len; i++ {
+		k := (i * 389) % Len
+		m.Insert(orderedCollider(k), k)
+	}
+	check("insert", func(i int) bool { return true })
+	for i := 0; i < Len; i++ {
+		if k := (i * 617) % Len; k%3 != 0 {
+			m.Remove(orderedCollider(k))
+		}
+	}
+	check("remove", func(i int) bool { return i%3 == 0 })
+	for i := 0; i < Len; i++ {
+		if k := (i * 389) % Len; k%3 != 0 && k%2 == 0 {
+			m.Insert(orderedCollider(k), k)
+		}
+	}
+	check("reinsert", func(i int) bool { return i%3 == 0 || i%2 == 0 })
+	for i := Len - 1; i >= 0; i-- {
+		if i%3 == 0 || i%2 == 0 {
+			m.Remove(orderedCollider(i))
+		}
+	}
+	check("empty", func(i int) bool { return false })
+}
+
+// Keys of two types collide all the time, and neither type's
+// Equal can deal with the other.
+func TestMixedColliders(t *testing.T) {
+	const Len = 1000
+	m := New()
+	for i := 0; i < Len; i++ {
+		m.Insert(collider(i), i)
+		m.Insert(orderedCollider(i), -i)
+	}
+	for i := 0; i < Len; i += 3 {
+		m.Remove(collider(i))
+	}
+	for i := 0; i < Len; i++ {
+		if m.Has(collider(i)) != (i%3 != 0) || m.At(orderedCollider(i)).(int) != -i {
+			t.Errorf("%d mixed up", i)
+		}
+	}
+}